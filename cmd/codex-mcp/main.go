@@ -10,12 +10,16 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/qiuxsgit/codex-mcp/internal/config"
 	"github.com/qiuxsgit/codex-mcp/internal/db"
 	"github.com/qiuxsgit/codex-mcp/internal/git"
+	"github.com/qiuxsgit/codex-mcp/internal/index"
+	"github.com/qiuxsgit/codex-mcp/internal/search"
 	"github.com/qiuxsgit/codex-mcp/internal/server"
 )
 
 // all: required so that _next/ (Next.js static assets) is embedded; Go excludes names starting with '_' by default.
+//
 //go:embed all:web/admin-dist
 var embedAdminFS embed.FS
 
@@ -23,6 +27,8 @@ func main() {
 	port := flag.String("port", "6688", "server port")
 	dbPath := flag.String("db-path", "./data/codex-mcp.db", "SQLite database path")
 	ignoreFilePath := flag.String("ignore-file-path", "./data/codex-ignore", "path to gitignore-format ignore file")
+	searchWorkers := flag.Int("search-workers", 0, "built-in search: number of files scanned in parallel (0 = GOMAXPROCS)")
+	exposePaths := flag.Bool("expose-paths", false, "list_codebases: include absolute directory paths in the response")
 	flag.Parse()
 
 	addr := ":" + *port
@@ -38,11 +44,35 @@ func main() {
 	}
 	defer db.Close()
 
+	// Per-directory ignore rules: parsed once, with rg's copies under the data directory.
+	if err := search.OpenDirectoryRules(dataDir); err != nil {
+		log.Fatalf("directory ignore rules: %v", err)
+	}
+
+	// Global ignore file: created with the default rules on first run, then loaded once and reloaded on change.
+	// Searches share the parsed rules and never touch the file.
+	if *ignoreFilePath != "" {
+		if _, err := config.ReadIgnoreFile(*ignoreFilePath); err != nil {
+			log.Printf("[ignore] read %s: %v", *ignoreFilePath, err)
+		}
+		if err := search.GlobalIgnore(*ignoreFilePath).Watch(); err != nil {
+			log.Printf("[ignore] watch %s: %v (changes made outside the admin API need a restart)", *ignoreFilePath, err)
+		}
+	}
+
+	// Trigram index (next to the DB) only helps the built-in engine; skip it when rg is installed.
+	if !search.RgAvailable() {
+		if err := index.Open(dataDir); err != nil {
+			log.Fatalf("index open: %v", err)
+		}
+		go refreshIndexes()
+	}
+
 	// Admin UI: Next.js SSG export embedded under web/admin-dist.
 	adminSub, _ := fs.Sub(embedAdminFS, "web/admin-dist")
 	adminFS := http.FS(adminSub)
 
-	srv := server.New(addr, *ignoreFilePath, adminFS)
+	srv := server.New(addr, *ignoreFilePath, *searchWorkers, *exposePaths, adminFS)
 	go runGitScheduler()
 
 	baseURL := "http://localhost:" + *port
@@ -77,6 +107,19 @@ func runGitScheduler() {
 			if err := db.UpdateDirectoryGitLastUpdated(d.ID, time.Now().UTC()); err != nil {
 				log.Printf("[git] update last_updated: %v", err)
 			}
+			search.RefreshIndex(d)
 		}
 	}
 }
+
+// refreshIndexes brings the trigram index of every enabled directory up to date at startup.
+func refreshIndexes() {
+	list, err := db.ListEnabledDirectories()
+	if err != nil {
+		log.Printf("[index] list directories: %v", err)
+		return
+	}
+	for _, d := range list {
+		search.RefreshIndex(d)
+	}
+}
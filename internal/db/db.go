@@ -19,6 +19,15 @@ CREATE TABLE IF NOT EXISTS directories (
 );
 `
 
+// directoryIgnoreDDL: per-directory ignore rules (gitignore format), layered on top of the global ignore file.
+const directoryIgnoreDDL = `
+CREATE TABLE IF NOT EXISTS directory_ignore_rules (
+  directory_id INTEGER PRIMARY KEY REFERENCES directories(id) ON DELETE CASCADE,
+  content TEXT NOT NULL,
+  updated_at DATETIME
+);
+`
+
 var conn *sql.DB
 
 // Open opens SQLite at dbPath and runs migrations.
@@ -37,8 +46,14 @@ func Open(dbPath string) error {
 		_ = conn.Close()
 		return err
 	}
-	// Migrate: add git columns if missing (existing DBs)
+	_, err = conn.Exec(directoryIgnoreDDL)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	// Migrate: add git / ignore columns if missing (existing DBs)
 	_ = migrateAddGitColumns()
+	_ = migrateAddIgnoreColumns()
 	return nil
 }
 
@@ -55,6 +70,14 @@ func migrateAddGitColumns() error {
 	return nil
 }
 
+func migrateAddIgnoreColumns() error {
+	_, err := conn.Exec(`ALTER TABLE directories ADD COLUMN use_vcs_ignore INTEGER DEFAULT 1`)
+	if err != nil && !strings.Contains(err.Error(), "duplicate column") {
+		return err
+	}
+	return nil
+}
+
 // DB returns the global connection (for tests or advanced use). Prefer package functions.
 func DB() *sql.DB {
 	return conn
@@ -32,13 +32,15 @@ type Directory struct {
 	UpdatedAt                  *time.Time `json:"updated_at,omitempty"`
 	GitAutoUpdateIntervalSec   int        `json:"git_auto_update_interval_sec"`
 	GitLastUpdatedAt           *time.Time `json:"git_last_updated_at,omitempty"`
+	UseVCSIgnore               bool       `json:"use_vcs_ignore"` // 搜索时遵循仓库的 .gitignore 与 .git/info/exclude
 }
 
 // List returns all directories.
 func ListDirectories() ([]Directory, error) {
 	rows, err := conn.Query(`
 		SELECT id, name, path, language, role, enabled, updated_at,
-		       COALESCE(git_auto_update_interval_sec, 0), git_last_updated_at
+		       COALESCE(git_auto_update_interval_sec, 0), git_last_updated_at,
+		       COALESCE(use_vcs_ignore, 1)
 		FROM directories ORDER BY id
 	`)
 	if err != nil {
@@ -48,13 +50,14 @@ func ListDirectories() ([]Directory, error) {
 	var out []Directory
 	for rows.Next() {
 		var d Directory
-		var en int
+		var en, vcs int
 		var uat, glat sql.NullTime
-		err = rows.Scan(&d.ID, &d.Name, &d.Path, &d.Language, &d.Role, &en, &uat, &d.GitAutoUpdateIntervalSec, &glat)
+		err = rows.Scan(&d.ID, &d.Name, &d.Path, &d.Language, &d.Role, &en, &uat, &d.GitAutoUpdateIntervalSec, &glat, &vcs)
 		if err != nil {
 			return nil, err
 		}
 		d.Enabled = en != 0
+		d.UseVCSIgnore = vcs != 0
 		if uat.Valid {
 			t := uat.Time
 			d.UpdatedAt = &t
@@ -72,7 +75,8 @@ func ListDirectories() ([]Directory, error) {
 func ListEnabledDirectories() ([]Directory, error) {
 	rows, err := conn.Query(`
 		SELECT id, name, path, language, role, enabled, updated_at,
-		       COALESCE(git_auto_update_interval_sec, 0), git_last_updated_at
+		       COALESCE(git_auto_update_interval_sec, 0), git_last_updated_at,
+		       COALESCE(use_vcs_ignore, 1)
 		FROM directories WHERE enabled = 1 ORDER BY id
 	`)
 	if err != nil {
@@ -82,13 +86,14 @@ func ListEnabledDirectories() ([]Directory, error) {
 	var out []Directory
 	for rows.Next() {
 		var d Directory
-		var en int
+		var en, vcs int
 		var uat, glat sql.NullTime
-		err = rows.Scan(&d.ID, &d.Name, &d.Path, &d.Language, &d.Role, &en, &uat, &d.GitAutoUpdateIntervalSec, &glat)
+		err = rows.Scan(&d.ID, &d.Name, &d.Path, &d.Language, &d.Role, &en, &uat, &d.GitAutoUpdateIntervalSec, &glat, &vcs)
 		if err != nil {
 			return nil, err
 		}
 		d.Enabled = en != 0
+		d.UseVCSIgnore = vcs != 0
 		if uat.Valid {
 			t := uat.Time
 			d.UpdatedAt = &t
@@ -123,13 +128,14 @@ func AddDirectory(name, path, language, role string) (int64, error) {
 func GetDirectoryByID(id int64) (*Directory, error) {
 	row := conn.QueryRow(`
 		SELECT id, name, path, language, role, enabled, updated_at,
-		       COALESCE(git_auto_update_interval_sec, 0), git_last_updated_at
+		       COALESCE(git_auto_update_interval_sec, 0), git_last_updated_at,
+		       COALESCE(use_vcs_ignore, 1)
 		FROM directories WHERE id = ?
 	`, id)
 	var d Directory
-	var en int
+	var en, vcs int
 	var uat, glat sql.NullTime
-	err := row.Scan(&d.ID, &d.Name, &d.Path, &d.Language, &d.Role, &en, &uat, &d.GitAutoUpdateIntervalSec, &glat)
+	err := row.Scan(&d.ID, &d.Name, &d.Path, &d.Language, &d.Role, &en, &uat, &d.GitAutoUpdateIntervalSec, &glat, &vcs)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -137,6 +143,7 @@ func GetDirectoryByID(id int64) (*Directory, error) {
 		return nil, err
 	}
 	d.Enabled = en != 0
+	d.UseVCSIgnore = vcs != 0
 	if uat.Valid {
 		t := uat.Time
 		d.UpdatedAt = &t
@@ -149,9 +156,21 @@ func GetDirectoryByID(id int64) (*Directory, error) {
 }
 
 // DeleteDirectory removes by id.
+// Its ignore rules are deleted with it here rather than by ON DELETE CASCADE, which needs foreign_keys on the
+// pooled connection.
 func DeleteDirectory(id int64) error {
-	_, err := conn.Exec(`DELETE FROM directories WHERE id = ?`, id)
-	return err
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM directory_ignore_rules WHERE directory_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM directories WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // SetEnabled sets enabled flag.
@@ -175,6 +194,40 @@ func SetDirectoryGitInterval(id int64, intervalSec int) error {
 	return err
 }
 
+// SetDirectoryUseVCSIgnore sets whether searches honor the directory's .gitignore and .git/info/exclude.
+func SetDirectoryUseVCSIgnore(id int64, use bool) error {
+	v := 0
+	if use {
+		v = 1
+	}
+	_, err := conn.Exec(`UPDATE directories SET use_vcs_ignore = ?, updated_at = ? WHERE id = ?`,
+		v, time.Now().UTC(), id)
+	return err
+}
+
+// GetDirectoryIgnoreRules returns the ignore rules stored for a directory ("" when none).
+func GetDirectoryIgnoreRules(id int64) (string, error) {
+	var content string
+	err := conn.QueryRow(`SELECT content FROM directory_ignore_rules WHERE directory_id = ?`, id).Scan(&content)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return content, err
+}
+
+// SetDirectoryIgnoreRules stores the ignore rules of a directory (gitignore format); empty content removes them.
+func SetDirectoryIgnoreRules(id int64, content string) error {
+	if content == "" {
+		_, err := conn.Exec(`DELETE FROM directory_ignore_rules WHERE directory_id = ?`, id)
+		return err
+	}
+	_, err := conn.Exec(`
+		INSERT INTO directory_ignore_rules (directory_id, content, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(directory_id) DO UPDATE SET content = excluded.content, updated_at = excluded.updated_at
+	`, id, content, time.Now().UTC())
+	return err
+}
+
 // UpdateDirectoryGitLastUpdated sets git_last_updated_at for a directory.
 func UpdateDirectoryGitLastUpdated(id int64, t time.Time) error {
 	_, err := conn.Exec(`UPDATE directories SET git_last_updated_at = ?, updated_at = ? WHERE id = ?`,
@@ -187,7 +240,8 @@ func UpdateDirectoryGitLastUpdated(id int64, t time.Time) error {
 func ListDirectoriesForGitUpdate(now time.Time) ([]Directory, error) {
 	rows, err := conn.Query(`
 		SELECT id, name, path, language, role, enabled, updated_at,
-		       COALESCE(git_auto_update_interval_sec, 0), git_last_updated_at
+		       COALESCE(git_auto_update_interval_sec, 0), git_last_updated_at,
+		       COALESCE(use_vcs_ignore, 1)
 		FROM directories
 		WHERE COALESCE(git_auto_update_interval_sec, 0) > 0
 		ORDER BY id
@@ -199,13 +253,14 @@ func ListDirectoriesForGitUpdate(now time.Time) ([]Directory, error) {
 	var out []Directory
 	for rows.Next() {
 		var d Directory
-		var en int
+		var en, vcs int
 		var uat, glat sql.NullTime
-		err = rows.Scan(&d.ID, &d.Name, &d.Path, &d.Language, &d.Role, &en, &uat, &d.GitAutoUpdateIntervalSec, &glat)
+		err = rows.Scan(&d.ID, &d.Name, &d.Path, &d.Language, &d.Role, &en, &uat, &d.GitAutoUpdateIntervalSec, &glat, &vcs)
 		if err != nil {
 			return nil, err
 		}
 		d.Enabled = en != 0
+		d.UseVCSIgnore = vcs != 0
 		if uat.Valid {
 			t := uat.Time
 			d.UpdatedAt = &t
@@ -4,6 +4,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 // IsGitRepo returns true if path is the root of a git repository.
@@ -23,3 +24,15 @@ func Pull(path string) error {
 	cmd.Stderr = nil
 	return cmd.Run()
 }
+
+// Head returns the commit hash of HEAD in path. Path must be a git repo root.
+func Head(path string) (string, error) {
+	if !IsGitRepo(path) {
+		return "", os.ErrNotExist
+	}
+	out, err := exec.Command("git", "-C", path, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
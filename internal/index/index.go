@@ -0,0 +1,406 @@
+package index
+
+import (
+	"encoding/gob"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxIndexedFileSize: larger files are recorded without trigrams and are always treated as candidates.
+const maxIndexedFileSize = 4 << 20
+
+// FileEntry is one indexed file. Entries are matched against the file on disk by size and mtime;
+// a mismatch means the entry is stale and the file must be scanned directly.
+type FileEntry struct {
+	Path      string // relative to Index.Root, slash-separated
+	Size      int64
+	ModTime   int64 // unix nanoseconds
+	Unindexed bool  // too large to index: always a candidate
+}
+
+// Index is a trigram inverted index for one registered directory (Zoekt / codesearch style).
+// Trigrams are taken over ASCII-lowercased bytes so one index serves case-sensitive and case-insensitive queries.
+// An Index is immutable once built; Refresh swaps in a new one.
+type Index struct {
+	DirID    int64
+	Root     string
+	Files    []FileEntry         // in walk order; position is the file id
+	Postings map[uint32][]uint32 // trigram -> sorted file ids
+	BuiltAt  time.Time
+
+	byPath map[string]uint32
+}
+
+// minStaleRefreshInterval: RefreshStale rebuilds a directory's index at most this often.
+const minStaleRefreshInterval = 30 * time.Second
+
+var (
+	mu          sync.Mutex
+	storeDir    string // "" = index disabled
+	loaded      = map[int64]*Index{}
+	refreshing  = map[int64]bool{}
+	refreshedAt = map[int64]time.Time{} // end of the last refresh (start of a pending RefreshStale)
+)
+
+// Open enables the index and stores index files under dataDir/index (next to the SQLite DB).
+func Open(dataDir string) error {
+	d := filepath.Join(dataDir, "index")
+	if err := os.MkdirAll(d, 0755); err != nil {
+		return err
+	}
+	mu.Lock()
+	storeDir = d
+	mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether Open has been called.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return storeDir != ""
+}
+
+// Get returns the index for a directory, loading it from disk on first use.
+// Returns nil if the index is disabled, not built yet, or was built for a different root.
+func Get(dirID int64, root string) *Index {
+	mu.Lock()
+	ix, ok := loaded[dirID]
+	d := storeDir
+	mu.Unlock()
+	if d == "" {
+		return nil
+	}
+	if !ok {
+		var err error
+		ix, err = load(filepath.Join(d, strconv.FormatInt(dirID, 10)+".gob"))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("[index] load %d: %v", dirID, err)
+			}
+			return nil
+		}
+		mu.Lock()
+		if cur, ok := loaded[dirID]; ok {
+			ix = cur // a concurrent Refresh won
+		} else {
+			loaded[dirID] = ix
+		}
+		mu.Unlock()
+	}
+	if ix.Root != root {
+		return nil
+	}
+	return ix
+}
+
+// Remove drops the index of a deleted directory.
+func Remove(dirID int64) {
+	mu.Lock()
+	d := storeDir
+	delete(loaded, dirID)
+	delete(refreshedAt, dirID)
+	mu.Unlock()
+	if d != "" {
+		_ = os.Remove(filepath.Join(d, strconv.FormatInt(dirID, 10)+".gob"))
+	}
+}
+
+// Refresh incrementally (re)builds the index of a directory: files whose size and mtime are unchanged
+// keep their trigrams, others are re-read. skipDir is called with slash-separated relative directory paths.
+// Concurrent refreshes of the same directory are coalesced.
+func Refresh(dirID int64, root string, skipDir func(rel string) bool) error {
+	mu.Lock()
+	d := storeDir
+	if d == "" || refreshing[dirID] {
+		mu.Unlock()
+		return nil
+	}
+	refreshing[dirID] = true
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		delete(refreshing, dirID)
+		refreshedAt[dirID] = time.Now()
+		mu.Unlock()
+	}()
+
+	start := time.Now()
+	old := Get(dirID, root)
+	ix, reused, err := build(dirID, root, old, skipDir)
+	if err != nil {
+		return err
+	}
+	if err := save(filepath.Join(d, strconv.FormatInt(dirID, 10)+".gob"), ix); err != nil {
+		return err
+	}
+	mu.Lock()
+	loaded[dirID] = ix
+	mu.Unlock()
+	log.Printf("[index] %s: %d files (%d reused), %d trigrams in %s", root, len(ix.Files), reused, len(ix.Postings), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// RefreshAsync runs Refresh in the background and logs errors.
+func RefreshAsync(dirID int64, root string, skipDir func(rel string) bool) {
+	go func() {
+		if err := Refresh(dirID, root, skipDir); err != nil {
+			log.Printf("[index] refresh %s: %v", root, err)
+		}
+	}()
+}
+
+// RefreshStale is RefreshAsync for searches that found stale or missing entries: a directory is refreshed
+// at most once per minStaleRefreshInterval, so a tree that keeps changing is not walked on every search.
+// It reports whether a refresh was started.
+func RefreshStale(dirID int64, root string, skipDir func(rel string) bool) bool {
+	mu.Lock()
+	if storeDir == "" || refreshing[dirID] || time.Since(refreshedAt[dirID]) < minStaleRefreshInterval {
+		mu.Unlock()
+		return false
+	}
+	refreshedAt[dirID] = time.Now()
+	mu.Unlock()
+	RefreshAsync(dirID, root, skipDir)
+	return true
+}
+
+func build(dirID int64, root string, old *Index, skipDir func(rel string) bool) (*Index, int, error) {
+	// Unchanged files keep their trigram sets from the old index.
+	var oldSets map[uint32][]uint32
+	if old != nil {
+		oldSets = old.fileTrigrams()
+	}
+	var files []FileEntry
+	var sets [][]uint32
+	reused := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, rErr := filepath.Rel(root, path)
+		if rErr != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && skipDir != nil && skipDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, iErr := d.Info()
+		if iErr != nil {
+			return nil
+		}
+		e := FileEntry{Path: rel, Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+		if old != nil {
+			if id, ok := old.byPath[rel]; ok {
+				oe := old.Files[id]
+				if oe.Size == e.Size && oe.ModTime == e.ModTime {
+					files = append(files, oe)
+					sets = append(sets, oldSets[id])
+					reused++
+					return nil
+				}
+			}
+		}
+		if e.Size > maxIndexedFileSize {
+			e.Unindexed = true
+			files = append(files, e)
+			sets = append(sets, nil)
+			return nil
+		}
+		data, rErr := os.ReadFile(path)
+		if rErr != nil {
+			return nil
+		}
+		files = append(files, e)
+		sets = append(sets, trigramSet(data))
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	ix := &Index{DirID: dirID, Root: root, Files: files, Postings: make(map[uint32][]uint32), BuiltAt: time.Now().UTC()}
+	for id, set := range sets {
+		for _, t := range set {
+			ix.Postings[t] = append(ix.Postings[t], uint32(id))
+		}
+	}
+	ix.initLookup()
+	return ix, reused, nil
+}
+
+// fileTrigrams inverts the postings back into per-file trigram sets (used for incremental rebuilds).
+func (ix *Index) fileTrigrams() map[uint32][]uint32 {
+	out := make(map[uint32][]uint32, len(ix.Files))
+	for t, ids := range ix.Postings {
+		for _, id := range ids {
+			out[id] = append(out[id], t)
+		}
+	}
+	return out
+}
+
+func (ix *Index) initLookup() {
+	ix.byPath = make(map[string]uint32, len(ix.Files))
+	for i, f := range ix.Files {
+		ix.byPath[f.Path] = uint32(i)
+	}
+}
+
+// Lookup returns the file id for rel if the entry still matches size and mtime on disk.
+// ok is false for unknown or stale files, which callers must scan directly.
+func (ix *Index) Lookup(rel string, size int64, modTime time.Time) (id uint32, ok bool) {
+	id, found := ix.byPath[rel]
+	if !found {
+		return 0, false
+	}
+	f := ix.Files[id]
+	if f.Size != size || f.ModTime != modTime.UnixNano() {
+		return 0, false
+	}
+	return id, true
+}
+
+// Candidates returns the ids of files that may contain at least one of lits.
+// fold must be true when the literals are matched case-insensitively.
+// all is true when lits give no usable trigram constraint (every file is a candidate).
+func (ix *Index) Candidates(lits []string, fold bool) (ids map[uint32]bool, all bool) {
+	if len(lits) == 0 {
+		return nil, true
+	}
+	ids = make(map[uint32]bool)
+	for _, lit := range lits {
+		tris := queryTrigrams(lit, fold)
+		if len(tris) == 0 {
+			return nil, true
+		}
+		var cur []uint32
+		for i, t := range tris {
+			p := ix.Postings[t]
+			if i == 0 {
+				cur = p
+			} else {
+				cur = intersect(cur, p)
+			}
+			if len(cur) == 0 {
+				break
+			}
+		}
+		for _, id := range cur {
+			ids[id] = true
+		}
+	}
+	for id, f := range ix.Files {
+		if f.Unindexed {
+			ids[uint32(id)] = true
+		}
+	}
+	return ids, false
+}
+
+func intersect(a, b []uint32) []uint32 {
+	var out []uint32
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return out
+}
+
+func lowerASCII(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + ('a' - 'A')
+	}
+	return b
+}
+
+func trigramOf(a, b, c byte) uint32 {
+	return uint32(lowerASCII(a))<<16 | uint32(lowerASCII(b))<<8 | uint32(lowerASCII(c))
+}
+
+// trigramSet returns the sorted distinct trigrams of data.
+func trigramSet(data []byte) []uint32 {
+	seen := make(map[uint32]struct{})
+	for i := 0; i+2 < len(data); i++ {
+		seen[trigramOf(data[i], data[i+1], data[i+2])] = struct{}{}
+	}
+	out := make([]uint32, 0, len(seen))
+	for t := range seen {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// queryTrigrams returns the trigrams a file must contain to hold lit.
+// With fold, Unicode case folding can match bytes the index never saw: non-ASCII letters have other-case forms
+// with different encodings, and 'k' / 's' also fold to U+212A KELVIN SIGN / U+017F LONG S. Trigrams touching
+// those bytes are dropped so the index never rejects a file the scanner would match.
+func queryTrigrams(lit string, fold bool) []uint32 {
+	var out []uint32
+	for i := 0; i+2 < len(lit); i++ {
+		if fold && (unsafeFold(lit[i]) || unsafeFold(lit[i+1]) || unsafeFold(lit[i+2])) {
+			continue
+		}
+		out = append(out, trigramOf(lit[i], lit[i+1], lit[i+2]))
+	}
+	return out
+}
+
+func unsafeFold(b byte) bool {
+	lb := lowerASCII(b)
+	return b >= 0x80 || lb == 'k' || lb == 's'
+}
+
+func load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ix Index
+	if err := gob.NewDecoder(f).Decode(&ix); err != nil {
+		return nil, err
+	}
+	ix.initLookup()
+	return &ix, nil
+}
+
+// save writes ix atomically (temp file + rename) so readers never see a partial index.
+func save(path string, ix *Index) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(tmp).Encode(ix); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
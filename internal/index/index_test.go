@@ -0,0 +1,53 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRefreshStaleRateLimited: searches that keep finding stale files start at most one refresh per
+// minStaleRefreshInterval for a directory.
+func TestRefreshStaleRateLimited(t *testing.T) {
+	if err := Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		mu.Lock()
+		storeDir = ""
+		mu.Unlock()
+	}()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "a.go"), []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	noSkip := func(string) bool { return false }
+	if err := Refresh(1, root, noSkip); err != nil {
+		t.Fatal(err)
+	}
+	if RefreshStale(1, root, noSkip) {
+		t.Fatal("refresh started right after a refresh")
+	}
+
+	mu.Lock()
+	refreshedAt[1] = time.Now().Add(-minStaleRefreshInterval)
+	old := loaded[1]
+	mu.Unlock()
+	if !RefreshStale(1, root, noSkip) {
+		t.Fatal("no refresh after the interval")
+	}
+	if RefreshStale(1, root, noSkip) {
+		t.Fatal("second refresh started while the first is pending")
+	}
+	// wait for the background refresh to swap in its index before the temp dirs go
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		done := loaded[1] != old
+		mu.Unlock()
+		if done {
+			return
+		}
+	}
+	t.Fatal("background refresh did not finish")
+}
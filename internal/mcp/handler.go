@@ -2,9 +2,13 @@ package mcp
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+	"github.com/qiuxsgit/codex-mcp/internal/git"
 	"github.com/qiuxsgit/codex-mcp/internal/search"
 )
 
@@ -13,21 +17,42 @@ const defaultLimit = 10
 
 // SearchRequest is the JSON body for POST /mcp/search_internal_codebase.
 type SearchRequest struct {
-	Query     string `json:"query"`
-	Language  string `json:"language"`
-	PathHint  string `json:"path_hint"`
-	Role      string `json:"role"` // 可选：前端 / 后端，限定搜索范围
-	Limit     int    `json:"limit"`
+	Query            string        `json:"query"`
+	Mode             string        `json:"mode"` // 可选：literal（默认）/ regex
+	Case             string        `json:"case"` // 可选：sensitive / insensitive / smart（默认）
+	WholeWord        bool          `json:"whole_word"`
+	Identifier       bool          `json:"identifier"`     // 可选：标识符边界（_ 与 $ 为单词字符）
+	Terms            []search.Term `json:"terms"`          // 可选：文件级布尔多词查询
+	Cursor           string        `json:"cursor"`         // 可选：上一页返回的 next_cursor
+	Sort             string        `json:"sort"`           // 可选：relevance（默认）/ path
+	ContextBefore    *int          `json:"context_before"` // 可选：匹配行之前的上下文行数，默认 7
+	ContextAfter     *int          `json:"context_after"`  // 可选：匹配行之后的上下文行数，默认 7
+	Language         string        `json:"language"`
+	PathHint         string        `json:"path_hint"`         // 可选：文件相对目录根的路径子串
+	IncludeGlobs     []string      `json:"include_globs"`     // 可选：只搜匹配的文件，如 src/**/*.go
+	ExcludeGlobs     []string      `json:"exclude_globs"`     // 可选：排除匹配的文件或目录，如 *_test.go
+	IncludeGenerated bool          `json:"include_generated"` // 可选：也搜索生成的文件与锁文件
+	Role             string        `json:"role"`              // 可选：前端 / 后端，限定搜索范围
+	Codebase         string        `json:"codebase"`          // 可选：目录名称或 ID，只搜该目录
+	Limit            int           `json:"limit"`
 }
 
 // SearchResponse is the JSON response.
 type SearchResponse struct {
-	Matches []search.Match `json:"matches"`
+	Matches    []search.Match `json:"matches"`
+	NextCursor string         `json:"next_cursor,omitempty"` // 还有更多结果时返回，下次请求带上 cursor 翻页
+}
+
+// ErrorResponse is the JSON body for invalid query input (e.g. a regex that does not compile).
+type ErrorResponse struct {
+	Error *search.QueryError `json:"error"`
 }
 
 // Handler holds dependencies for the MCP search endpoint.
 type Handler struct {
 	IgnoreFilePath string
+	SearchWorkers  int  // 内置引擎并发扫描数，<=0 时取 GOMAXPROCS
+	ExposePaths    bool // list_codebases 是否返回目录的绝对路径
 }
 
 // ServeSearch handles POST /mcp/search_internal_codebase.
@@ -41,7 +66,7 @@ func (h *Handler) ServeSearch(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
-	if req.Query == "" {
+	if req.Query == "" && len(req.Terms) == 0 {
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(SearchResponse{Matches: []search.Match{}})
 		return
@@ -55,21 +80,320 @@ func (h *Handler) ServeSearch(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("[search] limit=%d", limit)
 	params := search.Params{
-		Query:      req.Query,
+		Query:            req.Query,
+		Mode:             req.Mode,
+		Case:             req.Case,
+		WholeWord:        req.WholeWord,
+		Identifier:       req.Identifier,
+		Terms:            req.Terms,
+		Cursor:           req.Cursor,
+		Sort:             req.Sort,
+		ContextBefore:    req.ContextBefore,
+		ContextAfter:     req.ContextAfter,
+		Language:         req.Language,
+		PathHint:         req.PathHint,
+		IncludeGlobs:     req.IncludeGlobs,
+		ExcludeGlobs:     req.ExcludeGlobs,
+		IncludeGenerated: req.IncludeGenerated,
+		Role:             req.Role,
+		Codebase:         req.Codebase,
+		Limit:            limit,
+		IgnorePath:       h.IgnoreFilePath,
+		Workers:          h.SearchWorkers,
+	}
+	res, err := search.Search(params)
+	if err != nil {
+		writeError(w, err, "search", "search failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(SearchResponse{Matches: res.Matches, NextCursor: res.NextCursor}); err != nil {
+		log.Printf("[search] encode error: %v", err)
+	}
+}
+
+// DefinitionRequest is the JSON body for POST /mcp/find_definition.
+type DefinitionRequest struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`      // 可选：function / method / class / struct / interface / ...
+	Container string `json:"container"` // 可选：所属类型 / 类 / 模块
+	Language  string `json:"language"`
+	PathHint  string `json:"path_hint"`
+	Role      string `json:"role"`
+	Limit     int    `json:"limit"`
+}
+
+// DefinitionResponse is the JSON response of find_definition.
+type DefinitionResponse struct {
+	Definitions []search.Definition `json:"definitions"`
+}
+
+func (h *Handler) definitionParams(req DefinitionRequest) search.DefinitionParams {
+	return search.DefinitionParams{
+		Name:       req.Name,
+		Kind:       req.Kind,
+		Container:  req.Container,
 		Language:   req.Language,
 		PathHint:   req.PathHint,
 		Role:       req.Role,
-		Limit:      limit,
+		Limit:      req.Limit,
 		IgnorePath: h.IgnoreFilePath,
+		Workers:    h.SearchWorkers,
+	}
+}
+
+// ServeFindDefinition handles POST /mcp/find_definition.
+func (h *Handler) ServeFindDefinition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
-	matches, err := search.Search(params)
+	var req DefinitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	defs, err := search.FindDefinitions(h.definitionParams(req))
 	if err != nil {
-		log.Printf("[search] error: %v", err)
-		http.Error(w, "search failed", http.StatusInternalServerError)
+		writeError(w, err, "definition", "find definition failed")
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(SearchResponse{Matches: matches}); err != nil {
-		log.Printf("[search] encode error: %v", err)
+	if err := json.NewEncoder(w).Encode(DefinitionResponse{Definitions: defs}); err != nil {
+		log.Printf("[definition] encode error: %v", err)
+	}
+}
+
+// ReferenceRequest is the JSON body for POST /mcp/find_references.
+type ReferenceRequest struct {
+	Name      string `json:"name"`
+	Container string `json:"container"` // 可选：所属类型 / 类
+	Language  string `json:"language"`
+	PathHint  string `json:"path_hint"`
+	Role      string `json:"role"`
+	Limit     int    `json:"limit"`
+}
+
+func (h *Handler) referenceParams(req ReferenceRequest) search.ReferenceParams {
+	return search.ReferenceParams{
+		Name:       req.Name,
+		Container:  req.Container,
+		Language:   req.Language,
+		PathHint:   req.PathHint,
+		Role:       req.Role,
+		Limit:      req.Limit,
+		IgnorePath: h.IgnoreFilePath,
+		Workers:    h.SearchWorkers,
+	}
+}
+
+// ServeFindReferences handles POST /mcp/find_references.
+func (h *Handler) ServeFindReferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ReferenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	res, err := search.FindReferences(h.referenceParams(req))
+	if err != nil {
+		writeError(w, err, "references", "find references failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("[references] encode error: %v", err)
+	}
+}
+
+// FileRequest is the JSON body for POST /mcp/find_files.
+type FileRequest struct {
+	Pattern  string `json:"pattern"` // glob 或相对路径子串
+	Language string `json:"language"`
+	PathHint string `json:"path_hint"`
+	Role     string `json:"role"`
+	Limit    int    `json:"limit"`
+}
+
+func (h *Handler) fileParams(req FileRequest) search.FileParams {
+	return search.FileParams{
+		Pattern:    req.Pattern,
+		Language:   req.Language,
+		PathHint:   req.PathHint,
+		Role:       req.Role,
+		Limit:      req.Limit,
+		IgnorePath: h.IgnoreFilePath,
+	}
+}
+
+// ServeFindFiles handles POST /mcp/find_files.
+func (h *Handler) ServeFindFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req FileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	res, err := search.FindFiles(h.fileParams(req))
+	if err != nil {
+		writeError(w, err, "files", "find files failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("[files] encode error: %v", err)
+	}
+}
+
+// ReadRequest is the JSON body for POST /mcp/read_file.
+type ReadRequest struct {
+	Path      string `json:"path"`     // 绝对路径，或配合 codebase 的相对路径
+	Codebase  string `json:"codebase"` // 可选：目录名称或 ID
+	LineStart int    `json:"line_start"`
+	LineEnd   int    `json:"line_end"`
+}
+
+func (h *Handler) readParams(req ReadRequest) search.ReadParams {
+	return search.ReadParams{
+		Path:       req.Path,
+		Codebase:   req.Codebase,
+		LineStart:  req.LineStart,
+		LineEnd:    req.LineEnd,
+		IgnorePath: h.IgnoreFilePath,
+	}
+}
+
+// ServeReadFile handles POST /mcp/read_file.
+func (h *Handler) ServeReadFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	res, err := search.ReadFile(h.readParams(req))
+	if err != nil {
+		writeError(w, err, "read", "read file failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("[read] encode error: %v", err)
+	}
+}
+
+// TreeRequest is the JSON body for POST /mcp/list_tree.
+type TreeRequest struct {
+	Codebase   string `json:"codebase"` // 目录名称或 ID
+	Path       string `json:"path"`     // 可选：相对 codebase 的子路径
+	Depth      int    `json:"depth"`
+	MaxEntries int    `json:"max_entries"`
+}
+
+func (h *Handler) treeParams(req TreeRequest) search.TreeParams {
+	return search.TreeParams{
+		Codebase:   req.Codebase,
+		Path:       req.Path,
+		Depth:      req.Depth,
+		MaxEntries: req.MaxEntries,
+		IgnorePath: h.IgnoreFilePath,
+	}
+}
+
+// ServeListTree handles POST /mcp/list_tree.
+func (h *Handler) ServeListTree(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req TreeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	res, err := search.ListTree(h.treeParams(req))
+	if err != nil {
+		writeError(w, err, "tree", "list tree failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("[tree] encode error: %v", err)
+	}
+}
+
+// Codebase is an enabled directory as listed by list_codebases.
+type Codebase struct {
+	ID               int64      `json:"id"`
+	Name             string     `json:"name"`
+	Role             string     `json:"role"`
+	Language         string     `json:"language"`
+	Path             string     `json:"path,omitempty"`     // 仅在 --expose-paths 时返回
+	GitHead          string     `json:"git_head,omitempty"` // git 仓库的 HEAD commit
+	GitLastUpdatedAt *time.Time `json:"git_last_updated_at,omitempty"`
+}
+
+// CodebaseResponse is the JSON response of list_codebases.
+type CodebaseResponse struct {
+	Codebases []Codebase `json:"codebases"`
+}
+
+// listCodebases returns the enabled directories; absolute paths only when ExposePaths is set.
+func (h *Handler) listCodebases() ([]Codebase, error) {
+	dirs, err := db.ListEnabledDirectories()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Codebase, 0, len(dirs))
+	for _, d := range dirs {
+		c := Codebase{ID: d.ID, Name: d.Name, Role: d.Role, Language: d.Language, GitLastUpdatedAt: d.GitLastUpdatedAt}
+		if h.ExposePaths {
+			c.Path = d.Path
+		}
+		if head, err := git.Head(d.Path); err == nil {
+			c.GitHead = head
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// ServeListCodebases handles POST /mcp/list_codebases.
+func (h *Handler) ServeListCodebases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	list, err := h.listCodebases()
+	if err != nil {
+		writeError(w, err, "codebases", "list codebases failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(CodebaseResponse{Codebases: list}); err != nil {
+		log.Printf("[codebases] encode error: %v", err)
+	}
+}
+
+// writeError answers a failed request: a *search.QueryError (bad input the caller can fix) as 400 with the
+// structured error, anything else as 500 with msg, logged under tag.
+func writeError(w http.ResponseWriter, err error, tag, msg string) {
+	var qe *search.QueryError
+	if errors.As(err, &qe) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Error: qe})
+		return
 	}
+	log.Printf("[%s] error: %v", tag, err)
+	http.Error(w, msg, http.StatusInternalServerError)
 }
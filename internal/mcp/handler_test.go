@@ -0,0 +1,52 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qiuxsgit/codex-mcp/internal/search"
+)
+
+func TestWriteError(t *testing.T) {
+	qe := &search.QueryError{Code: "invalid_regex", Message: "bad", Query: "("}
+	rec := httptest.NewRecorder()
+	writeError(rec, fmt.Errorf("compile: %w", qe), "search", "search failed")
+	var body ErrorResponse
+	if rec.Code != http.StatusBadRequest || json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Error == nil || body.Error.Code != "invalid_regex" {
+		t.Errorf("query error: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	writeError(rec, errors.New("disk on fire"), "search", "search failed")
+	if rec.Code != http.StatusInternalServerError || rec.Body.String() != "search failed\n" {
+		t.Errorf("other error: %d %q", rec.Code, rec.Body)
+	}
+
+	if res := errorResult(qe, "search", "search failed"); !res.IsError || res.Content[0].Text != `{"error":{"code":"invalid_regex","message":"bad","query":"("}}` {
+		t.Errorf("tool query error: %+v", res)
+	}
+}
+
+// TestMethodNotAllowed: every REST endpoint accepts POST only.
+func TestMethodNotAllowed(t *testing.T) {
+	h := &Handler{}
+	for name, serve := range map[string]http.HandlerFunc{
+		"search_internal_codebase": h.ServeSearch,
+		"find_definition":          h.ServeFindDefinition,
+		"find_references":          h.ServeFindReferences,
+		"find_files":               h.ServeFindFiles,
+		"read_file":                h.ServeReadFile,
+		"list_tree":                h.ServeListTree,
+		"list_codebases":           h.ServeListCodebases,
+	} {
+		rec := httptest.NewRecorder()
+		serve(rec, httptest.NewRequest(http.MethodGet, "/mcp/"+name, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: %d", name, rec.Code)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
@@ -108,8 +109,12 @@ type inputSchema struct {
 }
 
 type propDef struct {
-	Type        string `json:"type"`
-	Description string `json:"description,omitempty"`
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Enum        []string           `json:"enum,omitempty"`
+	Items       *propDef           `json:"items,omitempty"`
+	Properties  map[string]propDef `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
 }
 
 // MCP tools/call params
@@ -199,17 +204,122 @@ func (h *Handler) handleToolsList() *toolsListResult {
 		Tools: []toolDef{
 			{
 				Name: "search_internal_codebase",
-				Description: "Search the configured codebase for exact text matches. Use this before implementing or refactoring: find where logic already exists, how APIs are used, or which files contain a pattern. Returns file path, line range, and snippet. Read-only and deterministic—no code generation. Prefer querying the codebase over guessing. Use get_supported_languages and get_supported_roles to get valid values for language and role params.",
+				Description: "Search the configured codebase for exact text matches. Use this before implementing or refactoring: find where logic already exists, how APIs are used, or which files contain a pattern. Returns file path, line range, and snippet, plus next_cursor when more matches exist. Read-only and deterministic—no code generation. Prefer querying the codebase over guessing. Use get_supported_languages and get_supported_roles to get valid values for language and role params.",
 				InputSchema: inputSchema{
 					Type: "object",
 					Properties: map[string]propDef{
-						"query":     {Type: "string", Description: "Required. The exact string or pattern to search for in source files. Use concrete identifiers (e.g. function name, type name, error message) for best results."},
-						"language":  {Type: "string", Description: "Optional. Filter by language. Call get_supported_languages for valid values (e.g. go, py, java, js, ts). Omit to search all languages."},
-						"path_hint": {Type: "string", Description: "Optional. Substring that must appear in the file path (e.g. package name, directory). Use to restrict search to a specific module or layer."},
-						"role":      {Type: "string", Description: "Optional. Limit scope to frontend or backend. Call get_supported_roles for valid values (前端 or 后端). Omit to search all."},
-						"limit":     {Type: "number", Description: "Optional. Max number of matches to return. Default 10, max 20."},
+						"query": {Type: "string", Description: "The exact string or pattern to search for in source files. Use concrete identifiers (e.g. function name, type name, error message) for best results. Required unless terms is given."},
+						"terms": {Type: "array", Description: "Optional. Boolean multi-term query evaluated per file: a file matches when it contains every and term, at least one or term (if any), and no not term. query, if set, counts as an and term. Snippets come from lines matching and/or terms. Example: [{\"text\":\"RedisClient\"},{\"text\":\"retry\"},{\"text\":\"_test\",\"op\":\"not\"}]", Items: &propDef{
+							Type: "object",
+							Properties: map[string]propDef{
+								"text": {Type: "string", Description: "Term text; uses the same mode/case/whole_word options as query."},
+								"op":   {Type: "string", Description: "and (default), or, not.", Enum: []string{search.OpAnd, search.OpOr, search.OpNot}},
+							},
+							Required: []string{"text"},
+						}},
+						"mode":              {Type: "string", Description: "Optional. literal (default): match query as plain text. regex: treat query as an RE2 regular expression (e.g. func (\\w+) Handle). Invalid regex returns an error with code invalid_regex.", Enum: []string{search.ModeLiteral, search.ModeRegex}},
+						"case":              {Type: "string", Description: "Optional. Case sensitivity. smart (default): case-sensitive only if the query contains an uppercase letter. sensitive / insensitive force the behavior.", Enum: []string{search.CaseSmart, search.CaseSensitive, search.CaseInsensitive}},
+						"whole_word":        {Type: "boolean", Description: "Optional. Only match whole words, e.g. User does not match UserService or currentUser."},
+						"identifier":        {Type: "boolean", Description: "Optional. Like whole_word, but also treats $ as an identifier character (Java/JS), so User does not match $User."},
+						"language":          {Type: "string", Description: "Optional. Filter by language. Call get_supported_languages for valid values (e.g. go, py, java, js, ts). Omit to search all languages."},
+						"path_hint":         {Type: "string", Description: "Optional. Substring that must appear in the file path relative to the codebase root (e.g. service/order, a package or directory name). Use to restrict search to a specific module or layer."},
+						"include_globs":     {Type: "array", Description: "Optional. Only search files matching one of these globs (rg -g semantics): without / a glob matches the file name (*.go, *Controller.java), with / the path from the codebase root (src/**/api/*.ts, ** spans directories); a trailing / means everything below that directory.", Items: &propDef{Type: "string"}},
+						"exclude_globs":     {Type: "array", Description: "Optional. Skip files and directories matching any of these globs (same syntax), e.g. *_test.go, test, docs/**.", Items: &propDef{Type: "string"}},
+						"include_generated": {Type: "boolean", Description: "Optional. Also search generated files, skipped by default: files with a 'Code generated ... DO NOT EDIT.' or '@generated' header and lock files (package-lock.json, go.sum, Cargo.lock, ...). Binary files are always skipped."},
+						"role":              {Type: "string", Description: "Optional. Limit scope to frontend or backend. Call get_supported_roles for valid values (前端 or 后端). Omit to search all."},
+						"codebase":          {Type: "string", Description: "Optional. Only search this codebase: name or id from list_codebases. Unknown values return error unknown_codebase."},
+						"limit":             {Type: "number", Description: "Optional. Max number of matches to return per page. Default 10, max 20; use cursor to get more."},
+						"sort":              {Type: "string", Description: "Optional. relevance (default): definitions (func X, class X, def X) first, non-test over test files, shorter paths, core dirs over docs/examples, files with more hits; each match has a score. Ranks the first 50 x limit matches in path order (at most 5000) together, so a page costs more than with path. path: directory, file and line order; cheapest for very common queries.", Enum: []string{search.SortRelevance, search.SortPath}},
+						"context_before":    {Type: "number", Description: "Optional. Lines of context before each matching line in the snippet. Default 7, max 50; 0 for none."},
+						"context_after":     {Type: "number", Description: "Optional. Lines of context after each matching line. Default 7, max 50. Hits whose snippets touch or overlap are merged into one snippet; match_lines lists the matching lines."},
+						"cursor":            {Type: "string", Description: "Optional. Opaque next_cursor from the previous result, to fetch the next page. Must be used with the same query parameters. Pages are best-effort if files change meanwhile: error cursor_stale is returned only when git HEAD moved (e.g. git pull), the file at the cursor changed or ignore rules changed - then search again without cursor."},
 					},
-					Required: []string{"query"},
+					Required: []string{},
+				},
+			},
+			{
+				Name:        "find_definition",
+				Description: "Find where a symbol (function, method, type, class, interface, field, ...) is defined, instead of grepping every usage. Parses Go with go/parser and Java, Kotlin, TypeScript/JavaScript, Python and Rust with ctags-style patterns. Returns kind, name, container (enclosing type/class/module), path and line range; definitions outside test/fixture dirs come first.",
+				InputSchema: inputSchema{
+					Type: "object",
+					Properties: map[string]propDef{
+						"name":      {Type: "string", Description: "Exact, case-sensitive symbol name (e.g. UserService, findById). Container.Name (e.g. UserService.findById) also restricts the container."},
+						"kind":      {Type: "string", Description: "Optional. Only this kind: function, method, constructor, class, interface, struct, enum, record, trait, object, type, module, field, property, variable, const, macro."},
+						"container": {Type: "string", Description: "Optional. Enclosing type, class, impl or module, e.g. the receiver type of a Go method."},
+						"language":  {Type: "string", Description: "Optional. Filter by language, same values as search_internal_codebase."},
+						"path_hint": {Type: "string", Description: "Optional. Same as search_internal_codebase."},
+						"role":      {Type: "string", Description: "Optional. Limit scope to frontend or backend (前端 or 后端)."},
+						"limit":     {Type: "number", Description: "Optional. Max number of definitions. Default 10, max 20."},
+					},
+					Required: []string{"name"},
+				},
+			},
+			{
+				Name:        "find_references",
+				Description: "Find where a symbol is used (who calls OrderService.cancel, who imports or extends a type) across all registered codebases. Matches the name as a whole, case-sensitive identifier and returns one result per line, grouped by codebase, with match_reason: call, import, type_ref, reference (other use), definition, string or comment. No type resolution: with Container.Name, only files that also mention Container are searched.",
+				InputSchema: inputSchema{
+					Type: "object",
+					Properties: map[string]propDef{
+						"name":      {Type: "string", Description: "Exact, case-sensitive symbol name (e.g. cancel), or Container.Name (e.g. OrderService.cancel)."},
+						"container": {Type: "string", Description: "Optional. Type or class the symbol belongs to; only files mentioning it are searched."},
+						"language":  {Type: "string", Description: "Optional. Filter by language, same values as search_internal_codebase."},
+						"path_hint": {Type: "string", Description: "Optional. Same as search_internal_codebase."},
+						"role":      {Type: "string", Description: "Optional. Limit scope to frontend or backend (前端 or 后端)."},
+						"limit":     {Type: "number", Description: "Optional. Max number of references. Default 50, max 200; truncated is true when more exist."},
+					},
+					Required: []string{"name"},
+				},
+			},
+			{
+				Name:        "find_files",
+				Description: "Find files by name or path, e.g. which files are named *Controller.java. Matches a glob or substring against paths relative to each codebase root, honoring the ignore rules. Returns path, size, language and mtime.",
+				InputSchema: inputSchema{
+					Type: "object",
+					Properties: map[string]propDef{
+						"pattern":   {Type: "string", Description: "Glob or substring. A glob without / matches the file name (*Controller.java, *.{ts,tsx}); with / it matches the whole relative path (src/**/api/*.go, ** spans directories). Anything without * ? [ { is a substring of the relative path. Case-sensitive only if the pattern has an uppercase letter. Empty lists all files."},
+						"language":  {Type: "string", Description: "Optional. Filter by language, same values as search_internal_codebase."},
+						"path_hint": {Type: "string", Description: "Optional. Same as search_internal_codebase."},
+						"role":      {Type: "string", Description: "Optional. Limit scope to frontend or backend (前端 or 后端)."},
+						"limit":     {Type: "number", Description: "Optional. Max number of files. Default 50, max 500; truncated is true when more match."},
+					},
+					Required: []string{},
+				},
+			},
+			{
+				Name:        "read_file",
+				Description: "Read a range of lines of a file found by search or find_files, e.g. the whole function around a match. The file must be inside a registered codebase and not excluded by the ignore rules; binary files are refused. Returns content, the returned line range, total_lines of the file and truncated when the range was cut short (max 1000 lines / 100 KB per call).",
+				InputSchema: inputSchema{
+					Type: "object",
+					Properties: map[string]propDef{
+						"path":       {Type: "string", Description: "Absolute path as returned by search, or a path relative to codebase."},
+						"codebase":   {Type: "string", Description: "Optional. Codebase (directory) name or id; path is then relative to its root."},
+						"line_start": {Type: "number", Description: "Optional. First line, 1-based. Default 1."},
+						"line_end":   {Type: "number", Description: "Optional. Last line, inclusive. Default line_start + 199."},
+					},
+					Required: []string{"path"},
+				},
+			},
+			{
+				Name:        "list_tree",
+				Description: "List the directory tree of a registered codebase, or of a directory inside it, to get oriented in an unfamiliar repo. Each entry has name, path (relative to the codebase root), type (dir or file) and size; directories also have files (file count down to depth, size is their total; deeper levels are not read). Ignored paths are left out. Entries are listed breadth first up to max_entries; a directory whose children are not all listed has omitted (how many were left out) — call again with its path to expand it.",
+				InputSchema: inputSchema{
+					Type: "object",
+					Properties: map[string]propDef{
+						"codebase":    {Type: "string", Description: "Codebase (directory) name or id."},
+						"path":        {Type: "string", Description: "Optional. Subdirectory relative to the codebase root; an absolute path when codebase is omitted."},
+						"depth":       {Type: "number", Description: "Optional. Levels to expand. Default 2, max 8."},
+						"max_entries": {Type: "number", Description: "Optional. Max entries listed. Default 200, max 1000; truncated is true when the budget collapsed directories."},
+					},
+					Required: []string{},
+				},
+			},
+			{
+				Name:        "list_codebases",
+				Description: "List the registered codebases (enabled directories) that all tools search: id, name, role (前端业务 / 后端业务 / 前端框架 / 后端框架), language, git_head (commit of HEAD, for git repositories) and git_last_updated_at (last git pull). Pass name or id as codebase to search_internal_codebase, read_file or list_tree to target one repo.",
+				InputSchema: inputSchema{
+					Type:       "object",
+					Properties: map[string]propDef{},
+					Required:   []string{},
 				},
 			},
 			{
@@ -245,6 +355,18 @@ func (h *Handler) handleToolsCall(params json.RawMessage) *toolsCallResult {
 	switch p.Name {
 	case "search_internal_codebase":
 		return h.handleSearch(p.Arguments)
+	case "find_definition":
+		return h.handleFindDefinition(p.Arguments)
+	case "find_references":
+		return h.handleFindReferences(p.Arguments)
+	case "find_files":
+		return h.handleFindFiles(p.Arguments)
+	case "read_file":
+		return h.handleReadFile(p.Arguments)
+	case "list_tree":
+		return h.handleListTree(p.Arguments)
+	case "list_codebases":
+		return h.handleListCodebases()
 	case "get_supported_languages":
 		return h.handleGetSupportedLanguages()
 	case "get_supported_roles":
@@ -276,25 +398,164 @@ func (h *Handler) handleSearch(args json.RawMessage) *toolsCallResult {
 	}
 	log.Printf("[search] limit=%d", limit)
 	searchParams := search.Params{
-		Query:      reqArgs.Query,
-		Language:   reqArgs.Language,
-		PathHint:   reqArgs.PathHint,
-		Role:       reqArgs.Role,
-		Limit:      limit,
-		IgnorePath: h.IgnoreFilePath,
-	}
-	matches, err := search.Search(searchParams)
+		Query:            reqArgs.Query,
+		Mode:             reqArgs.Mode,
+		Case:             reqArgs.Case,
+		WholeWord:        reqArgs.WholeWord,
+		Identifier:       reqArgs.Identifier,
+		Terms:            reqArgs.Terms,
+		Cursor:           reqArgs.Cursor,
+		Sort:             reqArgs.Sort,
+		ContextBefore:    reqArgs.ContextBefore,
+		ContextAfter:     reqArgs.ContextAfter,
+		Language:         reqArgs.Language,
+		PathHint:         reqArgs.PathHint,
+		IncludeGlobs:     reqArgs.IncludeGlobs,
+		ExcludeGlobs:     reqArgs.ExcludeGlobs,
+		IncludeGenerated: reqArgs.IncludeGenerated,
+		Role:             reqArgs.Role,
+		Codebase:         reqArgs.Codebase,
+		Limit:            limit,
+		IgnorePath:       h.IgnoreFilePath,
+		Workers:          h.SearchWorkers,
+	}
+	res, err := search.Search(searchParams)
+	if err != nil {
+		return errorResult(err, "search", "search failed")
+	}
+	out := SearchResponse{Matches: res.Matches, NextCursor: res.NextCursor}
+	text, _ := json.Marshal(out)
+	return &toolsCallResult{
+		Content: []contentItem{{Type: "text", Text: string(text)}},
+	}
+}
+
+func (h *Handler) handleFindDefinition(args json.RawMessage) *toolsCallResult {
+	var reqArgs DefinitionRequest
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &reqArgs); err != nil {
+			return &toolsCallResult{
+				Content: []contentItem{{Type: "text", Text: "invalid arguments"}},
+				IsError: true,
+			}
+		}
+	}
+	defs, err := search.FindDefinitions(h.definitionParams(reqArgs))
+	if err != nil {
+		return errorResult(err, "definition", "find definition failed")
+	}
+	text, _ := json.Marshal(DefinitionResponse{Definitions: defs})
+	return &toolsCallResult{
+		Content: []contentItem{{Type: "text", Text: string(text)}},
+	}
+}
+
+func (h *Handler) handleFindReferences(args json.RawMessage) *toolsCallResult {
+	var reqArgs ReferenceRequest
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &reqArgs); err != nil {
+			return &toolsCallResult{
+				Content: []contentItem{{Type: "text", Text: "invalid arguments"}},
+				IsError: true,
+			}
+		}
+	}
+	res, err := search.FindReferences(h.referenceParams(reqArgs))
+	if err != nil {
+		return errorResult(err, "references", "find references failed")
+	}
+	text, _ := json.Marshal(res)
+	return &toolsCallResult{
+		Content: []contentItem{{Type: "text", Text: string(text)}},
+	}
+}
+
+func (h *Handler) handleFindFiles(args json.RawMessage) *toolsCallResult {
+	var reqArgs FileRequest
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &reqArgs); err != nil {
+			return &toolsCallResult{
+				Content: []contentItem{{Type: "text", Text: "invalid arguments"}},
+				IsError: true,
+			}
+		}
+	}
+	res, err := search.FindFiles(h.fileParams(reqArgs))
 	if err != nil {
-		log.Printf("[search] error: %v", err)
+		return errorResult(err, "files", "find files failed")
+	}
+	text, _ := json.Marshal(res)
+	return &toolsCallResult{
+		Content: []contentItem{{Type: "text", Text: string(text)}},
+	}
+}
+
+func (h *Handler) handleReadFile(args json.RawMessage) *toolsCallResult {
+	var reqArgs ReadRequest
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &reqArgs); err != nil {
+			return &toolsCallResult{
+				Content: []contentItem{{Type: "text", Text: "invalid arguments"}},
+				IsError: true,
+			}
+		}
+	}
+	res, err := search.ReadFile(h.readParams(reqArgs))
+	if err != nil {
+		return errorResult(err, "read", "read file failed")
+	}
+	text, _ := json.Marshal(res)
+	return &toolsCallResult{
+		Content: []contentItem{{Type: "text", Text: string(text)}},
+	}
+}
+
+func (h *Handler) handleListTree(args json.RawMessage) *toolsCallResult {
+	var reqArgs TreeRequest
+	if len(args) > 0 {
+		if err := json.Unmarshal(args, &reqArgs); err != nil {
+			return &toolsCallResult{
+				Content: []contentItem{{Type: "text", Text: "invalid arguments"}},
+				IsError: true,
+			}
+		}
+	}
+	res, err := search.ListTree(h.treeParams(reqArgs))
+	if err != nil {
+		return errorResult(err, "tree", "list tree failed")
+	}
+	text, _ := json.Marshal(res)
+	return &toolsCallResult{
+		Content: []contentItem{{Type: "text", Text: string(text)}},
+	}
+}
+
+func (h *Handler) handleListCodebases() *toolsCallResult {
+	list, err := h.listCodebases()
+	if err != nil {
+		return errorResult(err, "codebases", "list codebases failed")
+	}
+	text, _ := json.Marshal(CodebaseResponse{Codebases: list})
+	return &toolsCallResult{
+		Content: []contentItem{{Type: "text", Text: string(text)}},
+	}
+}
+
+// errorResult turns a failed call into a tool error: a *search.QueryError as the structured error so agents can
+// fix their input (e.g. invalid regex), anything else as msg with the error, logged under tag.
+func errorResult(err error, tag, msg string) *toolsCallResult {
+	var qe *search.QueryError
+	if errors.As(err, &qe) {
+		text, _ := json.Marshal(ErrorResponse{Error: qe})
 		return &toolsCallResult{
-			Content: []contentItem{{Type: "text", Text: "search failed: " + err.Error()}},
+			Content: []contentItem{{Type: "text", Text: string(text)}},
 			IsError: true,
 		}
 	}
-	out := SearchResponse{Matches: matches}
-	text, _ := json.Marshal(out)
+	log.Printf("[%s] error: %v", tag, err)
 	return &toolsCallResult{
-		Content: []contentItem{{Type: "text", Text: string(text)}},
+		Content: []contentItem{{Type: "text", Text: msg + ": " + err.Error()}},
+		IsError: true,
 	}
 }
 
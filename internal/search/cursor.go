@@ -0,0 +1,209 @@
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+	"github.com/qiuxsgit/codex-mcp/internal/git"
+)
+
+// cursor is the decoded form of Result.NextCursor / Params.Cursor. Agents treat it as opaque.
+// It records the position of the last returned match (directory, file, line) plus fingerprints of the
+// query and of the tree at that position, so a page is never stitched onto results from a different query.
+// Pages are best-effort against a changing tree: a moved git HEAD (e.g. after a git pull) or a change to the
+// cursor's file is detected, other edits are not and may make later pages skip or repeat matches.
+//
+// With sort=relevance, matches are ranked within windows of Pool matches taken in path order (rankPool of the
+// first page's limit); Start is where the current window begins and Offset how many of its ranked matches
+// were returned.
+type cursor struct {
+	V      int        `json:"v"`
+	DirID  int64      `json:"d"`
+	Path   string     `json:"p"` // relative to the directory root, slash-separated
+	Line   int        `json:"l"`
+	Query  string     `json:"q"`           // queryFingerprint
+	Tree   string     `json:"f"`           // treeFingerprint
+	Ignore uint64     `json:"i,omitempty"` // version of the global ignore rules (IgnoreFile.Version)
+	Offset int        `json:"o,omitempty"`
+	Start  *cursorPos `json:"s,omitempty"` // nil: window starts at the beginning
+	Pool   int        `json:"n,omitempty"` // relevance: window size, kept when a later page asks another limit
+}
+
+type cursorPos struct {
+	DirID int64  `json:"d"`
+	Path  string `json:"p"`
+	Line  int    `json:"l"`
+}
+
+const cursorVersion = 1
+
+// position orders matches: directory (in roots order), then file in walk order, then line.
+type position struct {
+	dirIdx int
+	rel    string
+	line   int
+}
+
+// before reports whether c comes strictly before (dirIdx, rel, line), i.e. that position was not returned yet.
+func (c *position) before(dirIdx int, rel string, line int) bool {
+	if dirIdx != c.dirIdx {
+		return c.dirIdx < dirIdx
+	}
+	if rel != c.rel {
+		return walkLess(c.rel, rel)
+	}
+	return c.line < line
+}
+
+// resume is a decoded, validated cursor.
+type resume struct {
+	last   *position // last match returned
+	start  *position // relevance: window start (nil = beginning)
+	offset int       // relevance: ranked matches of the window already returned
+	pool   int       // relevance: window size (0 = rankPool of the limit)
+}
+
+func encodeCursor(c cursor) string {
+	c.V = cursorVersion
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func invalidCursor(msg string) error {
+	return &QueryError{Code: "invalid_cursor", Message: msg}
+}
+
+func staleCursor(msg string) error {
+	return &QueryError{Code: "cursor_stale", Message: msg}
+}
+
+// decodeCursor parses s and checks it against the current query and tree.
+func decodeCursor(s string, p Params, roots []db.Directory) (*resume, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalidCursor("cursor is malformed")
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.V != cursorVersion {
+		return nil, invalidCursor("cursor is malformed")
+	}
+	if c.Query != queryFingerprint(p) {
+		return nil, invalidCursor("cursor belongs to a different query; start again without cursor")
+	}
+	if c.Ignore != ignoreVersion(p) {
+		return nil, staleCursor("ignore rules changed since the cursor was issued; start again without cursor")
+	}
+	dirIdx := func(id int64) int {
+		for i, d := range roots {
+			if d.ID == id {
+				return i
+			}
+		}
+		return -1
+	}
+	r := &resume{offset: c.Offset, pool: c.Pool}
+	i := dirIdx(c.DirID)
+	if i < 0 {
+		return nil, staleCursor("directory of the cursor is no longer searchable; start again without cursor")
+	}
+	if treeFingerprint(roots[i].Path, c.Path) != c.Tree {
+		return nil, staleCursor("codebase changed since the cursor was issued (e.g. git pull); start again without cursor")
+	}
+	r.last = &position{dirIdx: i, rel: c.Path, line: c.Line}
+	if c.Start != nil {
+		j := dirIdx(c.Start.DirID)
+		if j < 0 {
+			return nil, staleCursor("directory of the cursor is no longer searchable; start again without cursor")
+		}
+		r.start = &position{dirIdx: j, rel: c.Start.Path, line: c.Start.Line}
+	}
+	return r, nil
+}
+
+// nextCursor builds the cursor that resumes after last. start, offset and pool are only used for sort=relevance.
+func nextCursor(p Params, roots []db.Directory, last Match, start *position, offset, pool int) string {
+	if last.dirIdx < 0 || last.dirIdx >= len(roots) {
+		return ""
+	}
+	d := roots[last.dirIdx]
+	rel := relSlash(filepath.Clean(d.Path), last.Path)
+	c := cursor{
+		DirID:  d.ID,
+		Path:   rel,
+		Line:   last.line,
+		Query:  queryFingerprint(p),
+		Tree:   treeFingerprint(d.Path, rel),
+		Ignore: ignoreVersion(p),
+		Offset: offset,
+		Pool:   pool,
+	}
+	if start != nil {
+		c.Start = &cursorPos{DirID: roots[start.dirIdx].ID, Path: start.rel, Line: start.line}
+	}
+	return encodeCursor(c)
+}
+
+func matchPosition(m Match, roots []db.Directory) *position {
+	return &position{dirIdx: m.dirIdx, rel: relSlash(filepath.Clean(roots[m.dirIdx].Path), m.Path), line: m.line}
+}
+
+// samePosition reports whether m sits at pos.
+func samePosition(m Match, pos *position, roots []db.Directory) bool {
+	return *matchPosition(m, roots) == *pos
+}
+
+// queryFingerprint hashes every parameter that changes which matches are returned or their order.
+func queryFingerprint(p Params) string {
+	key := struct {
+		Query, Mode, Case, Language, PathHint, Role, Codebase, Sort string
+		WholeWord, Identifier, IncludeGenerated                     bool
+		Terms                                                       []Term
+		IncludeGlobs, ExcludeGlobs                                  []string
+		Before, After                                               int
+	}{p.Query, p.Mode, p.Case, p.Language, p.PathHint, p.Role, p.Codebase, p.Sort, p.WholeWord, p.Identifier, p.IncludeGenerated, p.Terms, p.IncludeGlobs, p.ExcludeGlobs, 0, 0}
+	key.Before, key.After = p.contextLines()
+	data, _ := json.Marshal(key)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ignoreVersion returns the version of the global ignore rules p searches with, 0 when there is no ignore file.
+func ignoreVersion(p Params) uint64 {
+	if p.IgnorePath == "" {
+		return 0
+	}
+	return GlobalIgnore(p.IgnorePath).Version()
+}
+
+// treeFingerprint identifies the state of a directory at the cursor file: git HEAD (when it is a repository)
+// plus the cursor file's size and mtime. Files and directories elsewhere are not covered.
+func treeFingerprint(root, rel string) string {
+	var b strings.Builder
+	if head, err := git.Head(root); err == nil {
+		b.WriteString(head)
+	}
+	if info, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel))); err == nil {
+		b.WriteString("|" + strconv.FormatInt(info.Size(), 10) + "|" + strconv.FormatInt(info.ModTime().UnixNano(), 10))
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// walkLess reports whether slash-separated relative path a comes before b in filepath.WalkDir order
+// (entries sorted by name within each directory), which is also rg --sort path order.
+func walkLess(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
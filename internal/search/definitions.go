@@ -0,0 +1,202 @@
+package search
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+	"github.com/qiuxsgit/codex-mcp/internal/security"
+	"github.com/qiuxsgit/codex-mcp/internal/symbols"
+)
+
+// maxDefinitionFileSize: larger files (bundles, generated code) are not parsed for definitions.
+const maxDefinitionFileSize = 4 << 20
+
+// DefinitionParams for FindDefinitions.
+type DefinitionParams struct {
+	Name       string // 符号名，区分大小写的完整匹配；也可写作 Container.Name
+	Kind       string // 可选：function / method / class / struct / interface / ...
+	Container  string // 可选：所属类型、类或模块
+	Language   string // 可选语言过滤
+	PathHint   string // 可选路径子串
+	Role       string // 可选范围：前端 / 后端
+	Limit      int
+	IgnorePath string
+	Workers    int // 并发解析的文件数，<=0 时取 GOMAXPROCS
+}
+
+// Definition is one symbol definition found by FindDefinitions.
+type Definition struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Container string `json:"container,omitempty"` // enclosing type / class / impl / module
+	Path      string `json:"path"`
+	LineStart int    `json:"line_start"`
+	LineEnd   int    `json:"line_end"`
+	Language  string `json:"language"`
+}
+
+// FindDefinitions returns where a symbol is defined across the enabled directories.
+// The search engine (rg, or the built-in walker with the trigram index) narrows the files to those containing
+// the name as an identifier; those files are then parsed (go/parser for Go, ctags-style patterns otherwise).
+// Definitions outside test and fixture directories come first, then directory, file and line order.
+func FindDefinitions(p DefinitionParams) ([]Definition, error) {
+	if p.Limit <= 0 {
+		p.Limit = 10
+	}
+	if p.Limit > 20 {
+		p.Limit = 20
+	}
+	name, container := splitQualified(p.Name, p.Container)
+	if name == "" {
+		return nil, &QueryError{Code: "empty_query", Message: "name is required", Query: p.Name}
+	}
+	kind := normalizeOption(p.Kind)
+
+	paths, err := newPathFilter(p.PathHint, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := selectRoots(p.Role, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return []Definition{}, nil
+	}
+	allowedPaths := cleanPaths(roots)
+
+	sp := Params{Query: name, Case: CaseSensitive, Identifier: true, Language: p.Language, IgnorePath: p.IgnorePath, Workers: p.Workers, paths: paths}
+	q, err := compileQuery(sp)
+	if err != nil {
+		return nil, err
+	}
+	files, err := candidateFiles(sp, q, roots, allowedPaths)
+	if err != nil {
+		return nil, err
+	}
+	keep := func(s symbols.Symbol) bool {
+		if s.Name != name || (kind != "" && s.Kind != kind) {
+			return false
+		}
+		return container == "" || s.Container == container || strings.HasSuffix(s.Container, "."+container)
+	}
+	perFile := extractDefinitions(files, []byte(name), p.Workers, keep)
+
+	type ranked struct {
+		def   Definition
+		score float64
+	}
+	var all []ranked
+	for i, defs := range perFile {
+		root := filepath.Clean(roots[files[i].dirIdx].Path)
+		score := scorePath(relSlash(root, files[i].path))
+		for _, d := range defs {
+			all = append(all, ranked{def: d, score: score})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].score > all[j].score })
+	out := []Definition{}
+	for _, r := range all {
+		if len(out) >= p.Limit {
+			break
+		}
+		out = append(out, r.def)
+	}
+	return out, nil
+}
+
+// splitQualified splits "Container.Name" when no container is given explicitly.
+func splitQualified(name, container string) (string, string) {
+	name, container = strings.TrimSpace(name), strings.TrimSpace(container)
+	if i := strings.LastIndex(name, "."); i >= 0 && container == "" {
+		container, name = name[:i], name[i+1:]
+	}
+	return name, container
+}
+
+// candidateFiles lists, in search order, every file that may contain a match of q: rg -l when rg is installed,
+// otherwise the built-in walker narrowed by the trigram index.
+func candidateFiles(p Params, q *query, roots []db.Directory, allowedPaths []string) ([]scanTarget, error) {
+	if RgAvailable() {
+		files, ok, err := rgCandidateFiles(p, q, roots, nil)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			var allowed []scanTarget
+			for _, t := range files {
+				if security.IsPathAllowed(t.path, allowedPaths) {
+					allowed = append(allowed, t)
+				}
+			}
+			return allowed, nil
+		}
+	}
+	var files []scanTarget
+	walkTargets(p, q, roots, allowedPaths, nil, func(t scanTarget) bool {
+		files = append(files, t)
+		return true
+	})
+	return files, nil
+}
+
+// extractDefinitions parses files on a bounded pool of workers and returns, per file, the symbols keep accepts.
+// Files that do not contain name at all are not parsed.
+func extractDefinitions(files []scanTarget, name []byte, workers int, keep func(symbols.Symbol) bool) [][]Definition {
+	out := make([][]Definition, len(files))
+	parallelFiles(len(files), workers, func(i int) {
+		if symbols.Language(files[i].path) != "" {
+			out[i] = fileDefinitions(files[i].path, name, keep)
+		}
+	})
+	return out
+}
+
+// parallelFiles calls fn(0) ... fn(n-1) on a bounded pool of workers (GOMAXPROCS when workers <= 0)
+// and returns when all calls are done.
+func parallelFiles(n, workers int, fn func(i int)) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func fileDefinitions(path string, name []byte, keep func(symbols.Symbol) bool) []Definition {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxDefinitionFileSize {
+		return nil
+	}
+	src, err := os.ReadFile(path)
+	if err != nil || !bytes.Contains(src, name) {
+		return nil
+	}
+	var defs []Definition
+	lang := symbols.Language(path)
+	for _, s := range symbols.Extract(path, src) {
+		if keep(s) {
+			defs = append(defs, Definition{Kind: s.Kind, Name: s.Name, Container: s.Container, Path: path, LineStart: s.LineStart, LineEnd: s.LineEnd, Language: lang})
+		}
+	}
+	return defs
+}
@@ -0,0 +1,361 @@
+package search
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+)
+
+// Kinds of per-directory ignore files, by rg's precedence (highest first). .gitignore and .git/info/exclude
+// apply inside a git repository only, and only when the directory's use_vcs_ignore is on.
+const (
+	ignoreKindRg      = iota // .rgignore
+	ignoreKindIgnore         // .ignore
+	ignoreKindGit            // .gitignore
+	ignoreKindExclude        // .git/info/exclude, at the repository root
+	numIgnoreKinds
+)
+
+// dirIgnoreFiles are the ignore files read in every directory, indexed by kind.
+var dirIgnoreFiles = [...]string{ignoreKindRg: ".rgignore", ignoreKindIgnore: ".ignore", ignoreKindGit: ".gitignore"}
+
+// ignoreFileCache keeps parsed ignore files by path; an entry is reused while the file's mtime and size
+// are unchanged, so a walk only costs a stat per ignore file.
+var ignoreFileCache = struct {
+	sync.Mutex
+	m map[string]cachedIgnoreFile
+}{m: make(map[string]cachedIgnoreFile)}
+
+type cachedIgnoreFile struct {
+	modTime time.Time
+	size    int64
+	rules   *IgnoreRules // nil when the file has no rules
+}
+
+// readIgnoreFileCached returns the rules of the ignore file at path, or nil when it is missing or empty.
+func readIgnoreFileCached(path string) *IgnoreRules {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	ignoreFileCache.Lock()
+	c, ok := ignoreFileCache.m[path]
+	ignoreFileCache.Unlock()
+	if ok && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c.rules
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	rules := ParseIgnoreRules(data, path)
+	if len(rules.rules) == 0 {
+		rules = nil
+	}
+	ignoreFileCache.Lock()
+	ignoreFileCache.m[path] = cachedIgnoreFile{modTime: info.ModTime(), size: info.Size(), rules: rules}
+	ignoreFileCache.Unlock()
+	return rules
+}
+
+// ignoreLevel holds the ignore files of one directory.
+type ignoreLevel struct {
+	dir   string // relative to the search root, "" for the root and for directories above it
+	lead  string // directories above the root: path of the root below them, with a trailing '/'
+	rules [numIgnoreKinds]*IgnoreRules
+}
+
+// relOf returns rel (relative to the search root) relative to the level's directory.
+func (l *ignoreLevel) relOf(rel string) string {
+	if l.dir == "" {
+		return l.lead + rel
+	}
+	return rel[len(l.dir)+1:]
+}
+
+// dirIgnores decides what a walk of one root skips, the way rg does: the fixed directories, then the ignore
+// files found in the directories walked and in the directories above the root (.gitignore only up to the
+// enclosing git repository), the nearest directory first within each kind, and last the global rules.
+type dirIgnores struct {
+	global *IgnoreRules
+	vcs    bool          // .gitignore and .git/info/exclude apply
+	levels []ignoreLevel // directories with ignore files on the way down to the current one, outermost first
+	above  int           // levels[:above] are above the root
+}
+
+// newDirIgnores prepares the walk of directory dir: its own rules (directoryRules) are layered on top of the
+// global ones, and the ignore files of the directories above its root are read. Call enter for the root
+// before walking it.
+func newDirIgnores(dir db.Directory, global *IgnoreRules) *dirIgnores {
+	root := filepath.Clean(dir.Path)
+	d := &dirIgnores{global: global.with(directoryRules(dir))}
+	repo := ""
+	for cur := root; ; {
+		if _, err := os.Stat(filepath.Join(cur, ".git")); err == nil {
+			repo = cur
+			break
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			break
+		}
+		cur = parent
+	}
+	d.vcs = dir.UseVCSIgnore && repo != ""
+	// 与 rg 相同：.ignore / .rgignore 一直读到文件系统根，.gitignore 只读到所在仓库的根
+	inRepo := d.vcs && repo != root
+	var above []ignoreLevel
+	for cur := root; filepath.Dir(cur) != cur; {
+		cur = filepath.Dir(cur)
+		if l := d.load(cur, inRepo, inRepo && cur == repo); l != nil {
+			l.lead = relSlash(cur, root) + "/"
+			above = append([]ignoreLevel{*l}, above...)
+		}
+		if cur == repo {
+			inRepo = false
+		}
+	}
+	d.levels, d.above = above, len(above)
+	return d
+}
+
+// load reads the ignore files of dir; nil when it has none. vcs adds its .gitignore, and repoRoot the
+// repository's .git/info/exclude.
+func (d *dirIgnores) load(dir string, vcs, repoRoot bool) *ignoreLevel {
+	var l ignoreLevel
+	found := false
+	for kind, name := range dirIgnoreFiles {
+		if kind == ignoreKindGit && !vcs {
+			continue
+		}
+		if l.rules[kind] = readIgnoreFileCached(filepath.Join(dir, name)); l.rules[kind] != nil {
+			found = true
+		}
+	}
+	if repoRoot {
+		if l.rules[ignoreKindExclude] = readIgnoreFileCached(filepath.Join(dir, ".git", "info", "exclude")); l.rules[ignoreKindExclude] != nil {
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return &l
+}
+
+// enter loads the ignore files of the directory rel (at abs), which must not be excluded, before its entries
+// are checked. Directories the walk has left are dropped.
+func (d *dirIgnores) enter(rel, abs string) {
+	if rel == "." {
+		rel = ""
+	}
+	d.leave(rel)
+	if n := len(d.levels); n > d.above && d.levels[n-1].dir == rel {
+		return
+	}
+	_, err := os.Stat(filepath.Join(abs, ".git"))
+	if l := d.load(abs, d.vcs, d.vcs && err == nil); l != nil {
+		l.dir = rel
+		d.levels = append(d.levels, *l)
+	}
+}
+
+// leave drops the levels that are not dir or one of its parents.
+func (d *dirIgnores) leave(dir string) {
+	for n := len(d.levels); n > d.above; n-- {
+		l := d.levels[n-1].dir
+		if l == "" || l == dir || strings.HasPrefix(dir, l+"/") {
+			break
+		}
+		d.levels = d.levels[:n-1]
+	}
+}
+
+// excluded reports whether rel, an entry of the directory last entered (or of one of its parents), is ignored.
+func (d *dirIgnores) excluded(rel string, isDir bool) bool {
+	m := d.decide(rel, isDir)
+	return m != nil && !m.Negate
+}
+
+// decide returns the rule that decides rel (see excluded): a fixed directory, or the first matching rule in
+// precedence order, which may be a negation. It returns nil when no rule matches.
+func (d *dirIgnores) decide(rel string, isDir bool) *IgnoreRule {
+	if rel == "." || rel == "" {
+		return nil
+	}
+	i := strings.LastIndex(rel, "/")
+	if m := fixedIgnoreRules[rel[i+1:]]; m != nil {
+		return m
+	}
+	d.leave(rel[:max(i, 0)])
+	for kind := 0; kind < numIgnoreKinds; kind++ {
+		for k := len(d.levels) - 1; k >= 0; k-- {
+			l := &d.levels[k]
+			if l.rules[kind] == nil {
+				continue
+			}
+			if m := l.rules[kind].Match(l.relOf(rel), isDir); m != nil {
+				return m
+			}
+		}
+	}
+	return d.global.Match(rel, isDir)
+}
+
+// decidePath decides rel (relative to dir's root, slash-separated) the way a walk of dir would: the ignore
+// files of every directory on the way are read, and an excluded parent directory excludes everything below it.
+// It returns the deciding rule (nil when none matches; possibly a negation) and, when the rule excluded a
+// parent directory, that directory.
+func decidePath(dir db.Directory, global *IgnoreRules, rel string, isDir bool) (rule *IgnoreRule, via string) {
+	if rel == "." || rel == "" {
+		return nil, ""
+	}
+	root := filepath.Clean(dir.Path)
+	ignores := newDirIgnores(dir, global)
+	ignores.enter("", root)
+	for i := strings.IndexByte(rel, '/'); i >= 0; i = nextSlash(rel, i) {
+		if m := ignores.decide(rel[:i], true); m != nil && !m.Negate {
+			return m, rel[:i]
+		}
+		ignores.enter(rel[:i], filepath.Join(root, filepath.FromSlash(rel[:i])))
+	}
+	return ignores.decide(rel, isDir), ""
+}
+
+// storedRules caches the ignore rules stored for each directory (PUT /api/directories/{id}/ignore), parsed,
+// with the file handed to rg --ignore-file. Searches only read it; it changes when the rules are saved.
+var storedRules = struct {
+	sync.RWMutex
+	dir string // where rg's copies are written; "" until OpenDirectoryRules
+	m   map[int64]storedRule
+}{m: make(map[int64]storedRule)}
+
+type storedRule struct {
+	rules *IgnoreRules
+	file  string // for rg; "" when the copy could not be written
+}
+
+// OpenDirectoryRules loads the stored rules of every directory and writes rg's copies under
+// dataDir/ignore-rules. Copies of older versions are removed here only, before any search runs: a search never
+// sees its ignore file disappear under a running rg.
+func OpenDirectoryRules(dataDir string) error {
+	d := filepath.Join(dataDir, "ignore-rules")
+	if err := os.MkdirAll(d, 0755); err != nil {
+		return err
+	}
+	storedRules.Lock()
+	storedRules.dir = d
+	storedRules.Unlock()
+	dirs, err := db.ListDirectories()
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	for _, dir := range dirs {
+		if err := UpdateDirectoryRules(dir.ID); err != nil {
+			log.Printf("[ignore] directory %d rules: %v", dir.ID, err)
+		}
+		storedRules.RLock()
+		keep[storedRules.m[dir.ID].file] = true
+		storedRules.RUnlock()
+	}
+	old, _ := filepath.Glob(filepath.Join(d, "*"))
+	for _, f := range old {
+		if !keep[f] {
+			_ = os.Remove(f)
+		}
+	}
+	return nil
+}
+
+// UpdateDirectoryRules reloads the rules stored for directory id after they were saved, and writes rg's copy.
+// The copy is named after its content, so each version gets a new file and files in use are never rewritten.
+func UpdateDirectoryRules(id int64) error {
+	content, err := db.GetDirectoryIgnoreRules(id)
+	if err != nil {
+		return err
+	}
+	var r storedRule
+	if content != "" {
+		r.rules = ParseIgnoreRules([]byte(content), "directory:"+strconv.FormatInt(id, 10))
+		storedRules.RLock()
+		dir := storedRules.dir
+		storedRules.RUnlock()
+		if dir != "" {
+			r.file, err = writeRulesCopy(dir, id, content)
+		}
+	}
+	storedRules.Lock()
+	storedRules.m[id] = r
+	storedRules.Unlock()
+	return err
+}
+
+// RemoveDirectoryRules drops the rules cached for directory id after it was deleted, and removes rg's copy.
+func RemoveDirectoryRules(id int64) {
+	storedRules.Lock()
+	r := storedRules.m[id]
+	delete(storedRules.m, id)
+	storedRules.Unlock()
+	if r.file != "" {
+		_ = os.Remove(r.file)
+	}
+}
+
+// writeRulesCopy writes content to dir/<id>-<hash> unless that version exists already.
+func writeRulesCopy(dir string, id int64, content string) (string, error) {
+	sum := sha256.Sum256([]byte(content))
+	path := filepath.Join(dir, strconv.FormatInt(id, 10)+"-"+hex.EncodeToString(sum[:8]))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.WriteString(content)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return path, nil
+}
+
+// directoryRules returns the ignore rules stored for directory d, or nil.
+func directoryRules(d db.Directory) *IgnoreRules {
+	storedRules.RLock()
+	defer storedRules.RUnlock()
+	return storedRules.m[d.ID].rules
+}
+
+// with returns r followed by more: the rules of more take precedence, as the last matching rule decides.
+func (r *IgnoreRules) with(more *IgnoreRules) *IgnoreRules {
+	if more == nil || len(more.rules) == 0 {
+		return r
+	}
+	merged := &IgnoreRules{rules: make([]IgnoreRule, 0, len(r.rules)+len(more.rules))}
+	merged.rules = append(append(merged.rules, r.rules...), more.rules...)
+	return merged
+}
+
+// rgDirectoryIgnoreFile returns the file holding the ignore rules stored for directory d, for rg --ignore-file,
+// or "" when there are none.
+func rgDirectoryIgnoreFile(d db.Directory) string {
+	storedRules.RLock()
+	defer storedRules.RUnlock()
+	return storedRules.m[d.ID].file
+}
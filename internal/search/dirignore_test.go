@@ -0,0 +1,113 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+)
+
+// TestDecidePath: read_file and list_tree decide a single path with the ignore files a search walk would
+// read on the way to it, not only the global and stored rules.
+func TestDecidePath(t *testing.T) {
+	root := writeFixture(t, map[string]string{
+		".git/HEAD":          "ref: refs/heads/main\n",
+		".gitignore":         "*.log\n",
+		"app/.ignore":        "secret.txt\n",
+		"app/secret.txt":     "x\n",
+		"app/ok.txt":         "x\n",
+		"app/.gitignore":     "build/\n!keep.log\n",
+		"app/build/out.go":   "x\n",
+		"app/keep.log":       "x\n",
+		"app/other.log":      "x\n",
+		"docs/secret.txt":    "x\n",
+		"tmp/cache/entry.go": "x\n",
+	})
+	dir := db.Directory{ID: 1, Name: "fixture", Path: root, UseVCSIgnore: true}
+	global := ParseIgnoreRules([]byte("tmp/\n"), "global")
+	cases := []struct {
+		rel     string
+		ignored bool
+		via     string
+	}{
+		{"app/secret.txt", true, ""},
+		{"docs/secret.txt", false, ""},
+		{"app/ok.txt", false, ""},
+		{"app/build/out.go", true, "app/build"},
+		{"app/keep.log", false, ""},
+		{"app/other.log", true, ""},
+		{"tmp/cache/entry.go", true, "tmp"},
+		{".", false, ""},
+	}
+	for _, tc := range cases {
+		rule, via := decidePath(dir, global, tc.rel, false)
+		if ignored := rule != nil && !rule.Negate; ignored != tc.ignored || via != tc.via {
+			t.Errorf("%s: ignored=%v via=%q, want %v via %q", tc.rel, ignored, via, tc.ignored, tc.via)
+		}
+	}
+}
+
+// TestDecidePathAboveRootWithoutGit: outside a git repository the .ignore and .rgignore files above the root
+// still apply, as in rg; .gitignore files do not.
+func TestDecidePathAboveRootWithoutGit(t *testing.T) {
+	parent := writeFixture(t, map[string]string{
+		".ignore":        "proj/*.bak\n",
+		".rgignore":      "*.tmp\n",
+		".gitignore":     "*.go\n",
+		"proj/a.bak":     "x\n",
+		"proj/b.tmp":     "x\n",
+		"proj/main.go":   "package main\n",
+		"proj/sub/c.bak": "x\n",
+	})
+	dir := db.Directory{ID: 1, Name: "fixture", Path: filepath.Join(parent, "proj"), UseVCSIgnore: true}
+	global := ParseIgnoreRules(nil, "global")
+	for rel, want := range map[string]bool{"a.bak": true, "b.tmp": true, "main.go": false, "sub/c.bak": false} {
+		rule, _ := decidePath(dir, global, rel, false)
+		if ignored := rule != nil && !rule.Negate; ignored != want {
+			t.Errorf("%s: ignored=%v, want %v", rel, ignored, want)
+		}
+	}
+}
+
+// TestDeleteDirectoryRules: deleting a directory deletes its stored rules, and RemoveDirectoryRules drops the
+// cached rules and rg's copy.
+func TestDeleteDirectoryRules(t *testing.T) {
+	if err := db.Open(filepath.Join(t.TempDir(), "db.sqlite")); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	id, err := db.AddDirectory("fixture", t.TempDir(), "go", "后端业务")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetDirectoryIgnoreRules(id, "*.tmp\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := OpenDirectoryRules(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		storedRules.Lock()
+		storedRules.dir = ""
+		storedRules.Unlock()
+	}()
+	file := rgDirectoryIgnoreFile(db.Directory{ID: id})
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("rg copy: %v", err)
+	}
+
+	if err := db.DeleteDirectory(id); err != nil {
+		t.Fatal(err)
+	}
+	RemoveDirectoryRules(id)
+	if content, err := db.GetDirectoryIgnoreRules(id); content != "" || err != nil {
+		t.Errorf("stored rules left: %q, %v", content, err)
+	}
+	if directoryRules(db.Directory{ID: id}) != nil {
+		t.Error("cached rules left")
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("rg copy left: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package search
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+)
+
+// engineFixture is one tree both engines search. notes/ is excluded by .ignore, gen/ is generated and bin.dat
+// is binary, so every case also checks that the engines skip the same files.
+var engineFixture = map[string]string{
+	".ignore":        "notes/\n",
+	"main.go":        "package main\n\nfunc LoadUser() {}\n// loaduser helper\nvar LOADUSER = 1\n",
+	"util_test.go":   "package main\n// LoadUserX LoadUser\n",
+	"web/app.ts":     "export function loadUser() {}\n",
+	"web/view.tsx":   "const LoadUser = () => null\n",
+	"web/mod.mts":    "export const load_user = 1\n",
+	"conf/a.yaml":    "loadUser: true\n",
+	"conf/b.yml":     "LoadUser: false\n",
+	"notes/x.txt":    "LoadUser ignored\n",
+	"gen/gen.go":     "// Code generated by x. DO NOT EDIT.\npackage gen\n\nfunc LoadUser() {}\n",
+	"bin.dat":        "LoadUser\x00\x01\n",
+	"vendor/v.go":    "package v // LoadUser\n",
+	"node_modules/m": "LoadUser\n",
+}
+
+func writeFixture(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for rel, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// runEngine searches root with one engine and returns the hit lines as "rel:line", in result order.
+func runEngine(t *testing.T, useRg bool, p Params, root string) []string {
+	t.Helper()
+	hits := []string{}
+	for _, m := range engineMatches(t, useRg, p, root) {
+		for _, l := range m.MatchLines {
+			hits = append(hits, relSlash(root, m.Path)+":"+strconv.Itoa(l))
+		}
+	}
+	return hits
+}
+
+// engineMatches searches root with one engine.
+func engineMatches(t *testing.T, useRg bool, p Params, root string) []Match {
+	t.Helper()
+	p.Limit, p.maxBytes = 1000, 1<<20
+	q, err := compileQuery(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.paths, err = newPathFilter(p.PathHint, p.IncludeGlobs, p.ExcludeGlobs); err != nil {
+		t.Fatal(err)
+	}
+	roots := []db.Directory{{ID: 1, Name: "fixture", Path: root, UseVCSIgnore: true}}
+	matches, err := searchEngine(useRg, p, q, roots, cleanPaths(roots), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+// engines lists the engines to test: the built-in one, and rg when it is installed.
+func engines(t *testing.T) []bool {
+	if !RgAvailable() {
+		t.Log("rg not installed: checking the built-in engine only")
+		return []bool{false}
+	}
+	return []bool{false, true}
+}
+
+// TestEnginesGolden runs the built-in engine, and rg when it is installed, on engineFixture: both must return
+// exactly the golden hits.
+func TestEnginesGolden(t *testing.T) {
+	root := writeFixture(t, engineFixture)
+	all := []string{"conf/a.yaml:1", "conf/b.yml:1", "main.go:3", "main.go:4", "main.go:5", "util_test.go:2", "vendor/v.go:1", "web/app.ts:1", "web/view.tsx:1"}
+	exact := []string{"conf/b.yml:1", "main.go:3", "util_test.go:2", "vendor/v.go:1", "web/view.tsx:1"}
+	cases := []struct {
+		name string
+		p    Params
+		want []string
+	}{
+		{"smart lower case is insensitive", Params{Query: "loaduser"}, all},
+		{"smart upper case is sensitive", Params{Query: "LoadUser"}, exact},
+		{"sensitive", Params{Query: "loaduser", Case: CaseSensitive}, []string{"main.go:4"}},
+		{"insensitive", Params{Query: "LOADUSER", Case: CaseInsensitive}, all},
+		{"whole word", Params{Query: "LoadUser", WholeWord: true}, exact},
+		{"regex", Params{Query: `load_?user`, Mode: ModeRegex, Case: CaseInsensitive},
+			[]string{"conf/a.yaml:1", "conf/b.yml:1", "main.go:3", "main.go:4", "main.go:5", "util_test.go:2", "vendor/v.go:1", "web/app.ts:1", "web/mod.mts:1", "web/view.tsx:1"}},
+		{"language typescript", Params{Query: "load", Language: "typescript", Case: CaseInsensitive},
+			[]string{"web/app.ts:1", "web/mod.mts:1", "web/view.tsx:1"}},
+		{"language yaml", Params{Query: "loaduser", Language: "yml"}, []string{"conf/a.yaml:1", "conf/b.yml:1"}},
+		{"exclude glob", Params{Query: "LoadUser", ExcludeGlobs: []string{"*_test.go", "vendor"}},
+			[]string{"conf/b.yml:1", "main.go:3", "web/view.tsx:1"}},
+		{"include generated", Params{Query: "LoadUser", IncludeGenerated: true, IncludeGlobs: []string{"gen/"}}, []string{"gen/gen.go:4"}},
+		{"boolean terms", Params{Query: "LoadUser", Terms: []Term{{Text: "func", Op: OpNot}}},
+			[]string{"conf/b.yml:1", "util_test.go:2", "vendor/v.go:1", "web/view.tsx:1"}},
+	}
+	for _, tc := range cases {
+		for _, useRg := range engines(t) {
+			name := tc.name + "/builtin"
+			if useRg {
+				name = tc.name + "/rg"
+			}
+			t.Run(name, func(t *testing.T) {
+				p := tc.p
+				p.Sort = SortPath
+				if got := runEngine(t, useRg, p, root); !reflect.DeepEqual(got, tc.want) {
+					t.Errorf("got  %v\nwant %v", got, tc.want)
+				}
+			})
+		}
+	}
+}
+
+// TestEnginesBinaryAfterMatch: a NUL byte past the sniffed head ends the scan of a file, but the hits before it
+// are kept (flagged Binary) and their snippets stop before the binary line, as with rg.
+func TestEnginesBinaryAfterMatch(t *testing.T) {
+	filler := strings.Repeat("filler line\n", binarySniffBytes/12+100)
+	root := writeFixture(t, map[string]string{
+		"late.txt": "LoadUser before\n" + filler + "LoadUser near\nbin\x00ary\nLoadUser after\n",
+		"head.txt": "LoadUser\x00\n",
+		"text.txt": "LoadUser\n",
+	})
+	near := 2 + strings.Count(filler, "\n")
+	for _, useRg := range engines(t) {
+		got := []string{}
+		for _, m := range engineMatches(t, useRg, Params{Query: "LoadUser", Sort: SortPath}, root) {
+			if strings.Contains(m.Snippet, "\x00") {
+				t.Errorf("rg=%v: snippet of %s:%d has the binary line", useRg, relSlash(root, m.Path), m.LineStart)
+			}
+			for _, l := range m.MatchLines {
+				got = append(got, fmt.Sprintf("%s:%d:%v", relSlash(root, m.Path), l, m.Binary))
+			}
+		}
+		want := []string{"late.txt:1:true", fmt.Sprintf("late.txt:%d:true", near), "text.txt:1:false"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("rg=%v: got %v, want %v", useRg, got, want)
+		}
+	}
+}
+
+// TestReadSnippetsStopsAtBinary covers the rg engine without rg: snippets of the hits rg reports end before
+// the binary line, and hits from it on are dropped.
+func TestReadSnippetsStopsAtBinary(t *testing.T) {
+	root := writeFixture(t, map[string]string{"f.txt": "a hit\nctx\nb hit\nbin\x00ary\nc hit\n"})
+	path := filepath.Join(root, "f.txt")
+	g := newHitGrouper(1, 1, false)
+	for _, n := range []int{1, 3, 5} {
+		g.add(lineHit{num: n, text: "hit", locs: [][]int{{2, 5}}})
+	}
+	groups, binary := readSnippets(path, g.groups, true)
+	if !binary || len(groups) != 1 {
+		t.Fatalf("binary=%v, %d groups, want true and 1 (lines 1-3)", binary, len(groups))
+	}
+	if got := strings.Join(groups[0].lines, "|"); got != "a hit|ctx|b hit" || len(groups[0].hits) != 2 {
+		t.Errorf("snippet %q with %d hits", got, len(groups[0].hits))
+	}
+}
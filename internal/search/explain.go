@@ -0,0 +1,184 @@
+package search
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+)
+
+// maxIgnoreChanges caps the paths listed per directory by DiffIgnoreRules; the file counts stay exact.
+const maxIgnoreChanges = 500
+
+// IgnoreExplanation tells why a path is, or is not, excluded from search.
+type IgnoreExplanation struct {
+	Path      string      `json:"path"`
+	Codebase  string      `json:"codebase"`
+	Rel       string      `json:"rel"` // relative to the directory root, slash-separated
+	Dir       bool        `json:"dir"`
+	Ignored   bool        `json:"ignored"`
+	Rule      *IgnoreRule `json:"rule,omitempty"`      // deciding rule; a negation when the path is explicitly re-included
+	Via       string      `json:"via,omitempty"`       // excluded parent directory the path lies under, when Rule matched it
+	Generated bool        `json:"generated,omitempty"` // not ignored, but skipped by content search unless include_generated
+	Binary    bool        `json:"binary,omitempty"`    // not ignored, but never searched
+}
+
+// ExplainIgnore reports the rule that decides whether path is searched, with its source: the global ignore
+// file, a directory's stored rules ("directory:<id>"), an ignore file of the tree (.gitignore, .ignore,
+// .rgignore, .git/info/exclude) or a fixed directory ("fixed"). path is absolute, or relative to codebase.
+func ExplainIgnore(path, codebase, ignorePath string) (*IgnoreExplanation, error) {
+	abs, root, err := resolveInDirectory(path, codebase, false)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, &QueryError{Code: "not_found", Message: "file not found", Query: path}
+	}
+	rel := relSlash(filepath.Clean(root.Path), abs)
+	e := &IgnoreExplanation{Path: abs, Codebase: root.Name, Rel: rel, Dir: info.IsDir()}
+	if rel == "." {
+		return e, nil
+	}
+	e.Rule, e.Via = decidePath(root, loadIgnoreRules(ignorePath), rel, e.Dir)
+	e.Ignored = e.Rule != nil && !e.Rule.Negate
+	if e.Via != "" {
+		return e, nil
+	}
+	if !e.Ignored && !e.Dir {
+		if f, err := os.Open(abs); err == nil {
+			head, _ := bufio.NewReaderSize(f, binarySniffBytes).Peek(binarySniffBytes)
+			_ = f.Close()
+			e.Binary = isBinaryHead(head)
+			e.Generated = !e.Binary && (isLockFile(abs) || isGeneratedHead(head))
+		}
+	}
+	return e, nil
+}
+
+// IgnoreChange is a path whose ignore state differs between the saved and the candidate rules. A directory
+// stands for its whole subtree and is not descended into in the listing.
+type IgnoreChange struct {
+	Path          string      `json:"path"` // relative to the directory root, slash-separated
+	Dir           bool        `json:"dir,omitempty"`
+	Files         int         `json:"files"`                    // files whose state changes (1 for a file)
+	Rule          *IgnoreRule `json:"rule,omitempty"`           // deciding rule with the saved global file
+	CandidateRule *IgnoreRule `json:"candidate_rule,omitempty"` // deciding rule with the candidate content
+}
+
+// IgnoreDiff lists, for one directory, what the candidate global ignore content would change.
+type IgnoreDiff struct {
+	DirectoryID   int64          `json:"directory_id"`
+	Codebase      string         `json:"codebase"`
+	Excluded      []IgnoreChange `json:"excluded"` // searched now, excluded with the candidate
+	Included      []IgnoreChange `json:"included"` // excluded now, searched with the candidate
+	ExcludedFiles int            `json:"excluded_files"`
+	IncludedFiles int            `json:"included_files"`
+	Truncated     bool           `json:"truncated,omitempty"` // more than maxIgnoreChanges paths; counts are complete
+}
+
+// DiffIgnoreRules walks each directory with the saved global ignore file and with candidate in its place
+// (nothing is written) and returns the paths whose state would change. Per-directory rules and the ignore
+// files of the tree apply on both sides.
+func DiffIgnoreRules(candidate []byte, ignorePath string, dirs []db.Directory) []IgnoreDiff {
+	saved := loadIgnoreRules(ignorePath)
+	cand := ParseIgnoreRules(candidate, "candidate")
+	out := make([]IgnoreDiff, 0, len(dirs))
+	for _, dir := range dirs {
+		out = append(out, diffIgnoreDir(dir, saved, cand))
+	}
+	return out
+}
+
+func diffIgnoreDir(dir db.Directory, saved, cand *IgnoreRules) IgnoreDiff {
+	res := IgnoreDiff{DirectoryID: dir.ID, Codebase: dir.Name, Excluded: []IgnoreChange{}, Included: []IgnoreChange{}}
+	root := filepath.Clean(dir.Path)
+	old, neu := newDirIgnores(dir, saved), newDirIgnores(dir, cand)
+	// oldOut / newOut: directory excluded on that side that the walk is in; changed: directory listed as a change
+	var oldOut, newOut string
+	var changed *IgnoreChange
+	under := func(rel, dir string) bool { return dir != "" && strings.HasPrefix(rel, dir+"/") }
+	_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel := relSlash(root, filepath.Clean(path))
+		if rel == "." {
+			old.enter("", root)
+			neu.enter("", root)
+			return nil
+		}
+		isDir := d.IsDir()
+		if !under(rel, oldOut) {
+			oldOut = ""
+		}
+		if !under(rel, newOut) {
+			newOut = ""
+		}
+		if changed != nil && !under(rel, changed.Path) {
+			changed = nil
+		}
+		var oldRule, newRule *IgnoreRule
+		oldEx, newEx := oldOut != "", newOut != ""
+		if !oldEx {
+			oldRule = old.decide(rel, isDir)
+			oldEx = oldRule != nil && !oldRule.Negate
+		}
+		if !newEx {
+			newRule = neu.decide(rel, isDir)
+			newEx = newRule != nil && !newRule.Negate
+		}
+		if oldEx && newEx {
+			if isDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isDir {
+			if oldEx && oldOut == "" {
+				oldOut = rel
+			}
+			if newEx && newOut == "" {
+				newOut = rel
+			}
+			if !oldEx {
+				old.enter(rel, path)
+			}
+			if !newEx {
+				neu.enter(rel, path)
+			}
+		}
+		if oldEx == newEx {
+			return nil
+		}
+		list, count := &res.Included, &res.IncludedFiles
+		if newEx {
+			list, count = &res.Excluded, &res.ExcludedFiles
+		}
+		if !isDir {
+			*count++
+		}
+		if changed != nil {
+			if !isDir {
+				changed.Files++
+			}
+			return nil
+		}
+		c := IgnoreChange{Path: rel, Dir: isDir, Rule: oldRule, CandidateRule: newRule}
+		if !isDir {
+			c.Files = 1
+		}
+		if len(res.Excluded)+len(res.Included) >= maxIgnoreChanges {
+			res.Truncated = true
+			return nil
+		}
+		*list = append(*list, c)
+		if isDir {
+			changed = &(*list)[len(*list)-1]
+		}
+		return nil
+	})
+	return res
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+)
+
+// TestExplainIgnoreResolvesLikeRead: ExplainIgnore accepts and rejects the same paths as read_file, including a
+// symlink that leads out of the enabled directory, and reports the rule read_file applies; an in-tree symlink is
+// decided on its target.
+func TestExplainIgnoreResolvesLikeRead(t *testing.T) {
+	if err := db.Open(filepath.Join(t.TempDir(), "db.sqlite")); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	outside := writeFixture(t, map[string]string{"secret.txt": "x\n"})
+	root := writeFixture(t, map[string]string{".ignore": "*.tmp\n", "a.tmp": "x\n", "main.go": "package main\n"})
+	for link, target := range map[string]string{"escape": outside, "alias.txt": "a.tmp", "main-link.go": "main.go"} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	if _, err := db.AddDirectory("fixture", root, "go", "后端业务"); err != nil {
+		t.Fatal(err)
+	}
+	ignorePath := filepath.Join(t.TempDir(), "ignore")
+
+	for _, tc := range []struct {
+		path, code string
+		ignored    bool
+	}{
+		{"escape/secret.txt", "path_not_allowed", false},
+		{"missing.go", "not_found", false},
+		{"a.tmp", "", true},
+		{"main.go", "", false},
+		{"alias.txt", "", true}, // decided on the target, a.tmp
+		{"main-link.go", "", false},
+	} {
+		e, err := ExplainIgnore(tc.path, "fixture", ignorePath)
+		_, _, readErr := resolvePath(tc.path, "fixture", ignorePath, false)
+		var qe *QueryError
+		if tc.code != "" {
+			if !errors.As(err, &qe) || qe.Code != tc.code {
+				t.Errorf("%s: explain error %v, want %s", tc.path, err, tc.code)
+			}
+			if !errors.As(readErr, &qe) || qe.Code != tc.code {
+				t.Errorf("%s: read error %v, want %s", tc.path, readErr, tc.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		if e.Ignored != tc.ignored || (readErr != nil) != tc.ignored {
+			t.Errorf("%s: explain ignored=%v, read error %v, want ignored=%v", tc.path, e.Ignored, readErr, tc.ignored)
+		}
+	}
+
+	// read_file opens the path the rules were checked on
+	if abs, _, err := resolvePath("main-link.go", "fixture", ignorePath, false); err != nil || abs != filepath.Join(root, "main.go") {
+		t.Errorf("main-link.go resolved to %q, %v; want %s", abs, err, filepath.Join(root, "main.go"))
+	}
+}
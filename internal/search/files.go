@@ -0,0 +1,174 @@
+package search
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+	"github.com/qiuxsgit/codex-mcp/internal/security"
+)
+
+const (
+	defaultFileLimit = 50
+	maxFileLimit     = 500
+)
+
+// FileParams for FindFiles.
+type FileParams struct {
+	Pattern    string // glob（*Controller.java、src/**/*.ts）或相对路径子串；为空时列出全部文件
+	Language   string // 可选语言过滤
+	PathHint   string // 可选路径子串
+	Role       string // 可选范围：前端 / 后端
+	Limit      int
+	IgnorePath string
+}
+
+// File is one file found by FindFiles.
+type File struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Language string    `json:"language,omitempty"`
+	ModTime  time.Time `json:"mtime"`
+}
+
+// FileResult is the result of FindFiles. Truncated is set when more files match than Limit.
+type FileResult struct {
+	Files     []File `json:"files"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// FindFiles lists files of the enabled directories whose path relative to the directory root matches
+// p.Pattern, honoring the ignore file and the fixed ignore dirs. A glob without '/' is matched against the
+// file name, one with '/' against the whole relative path; any other pattern is a substring of the relative
+// path. Case follows smart case: the match is case-sensitive only if the pattern has an uppercase letter.
+// Files come in directory, then walk order; rg --files is used when rg is installed.
+func FindFiles(p FileParams) (*FileResult, error) {
+	if p.Limit <= 0 {
+		p.Limit = defaultFileLimit
+	}
+	if p.Limit > maxFileLimit {
+		p.Limit = maxFileLimit
+	}
+	match, err := pathMatcher(strings.TrimSpace(p.Pattern))
+	if err != nil {
+		return nil, err
+	}
+	paths, err := newPathFilter(p.PathHint, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &FileResult{Files: []File{}}
+	roots, err := selectRoots(p.Role, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return res, nil
+	}
+	allowedPaths := cleanPaths(roots)
+
+	sp := Params{Language: p.Language, IgnorePath: p.IgnorePath, paths: paths}
+	err = listFiles(sp, roots, allowedPaths, func(dirIdx int, path string) bool {
+		if !match(relSlash(filepath.Clean(roots[dirIdx].Path), path)) {
+			return true
+		}
+		if len(res.Files) >= p.Limit {
+			res.Truncated = true
+			return false
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return true
+		}
+		res.Files = append(res.Files, File{Path: path, Size: info.Size(), Language: languageOf(path), ModTime: info.ModTime().UTC()})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// pathMatcher returns the predicate for a FindFiles pattern over slash-separated relative paths.
+func pathMatcher(pattern string) (func(rel string) bool, error) {
+	fold := !hasUpper(pattern)
+	if pattern == "" {
+		return func(string) bool { return true }, nil
+	}
+	if !isGlob(pattern) {
+		if fold {
+			pattern = strings.ToLower(pattern)
+			return func(rel string) bool { return strings.Contains(strings.ToLower(rel), pattern) }, nil
+		}
+		return func(rel string) bool { return strings.Contains(rel, pattern) }, nil
+	}
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	re, err := compileGlob(strings.TrimPrefix(pattern, "/"), fold)
+	if err != nil {
+		return nil, err
+	}
+	if anchored {
+		return re.MatchString, nil
+	}
+	return func(rel string) bool { return re.MatchString(rel[strings.LastIndex(rel, "/")+1:]) }, nil
+}
+
+// listFiles calls fn with every searchable file of roots, in directory and walk order, until fn returns false.
+// It uses rg --files (honoring the same ignore rules as content search) or the built-in walker.
+func listFiles(p Params, roots []db.Directory, allowedPaths []string, fn func(dirIdx int, path string) bool) error {
+	if !RgAvailable() {
+		walkTargets(p, nil, roots, allowedPaths, nil, func(t scanTarget) bool {
+			return fn(t.dirIdx, t.path)
+		})
+		return nil
+	}
+	for dirIdx, d := range roots {
+		root := filepath.Clean(d.Path)
+		args := append([]string{"--files", "--sort", "path"}, rgBaseArgs(p, d)...)
+		args = append(args, "--", root)
+		stdout, err := runRg(root, args)
+		if err != nil {
+			return err
+		}
+		sc := bufio.NewScanner(stdout)
+		for sc.Scan() {
+			path := filepath.Clean(sc.Text())
+			if !security.IsPathAllowed(path, allowedPaths) || !p.paths.keep(relSlash(root, path)) {
+				continue
+			}
+			if !fn(dirIdx, path) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// extLanguages inverts languageExts: extension -> language. An extension listed under several languages
+// (.h: c and cpp) goes to the first of them in name order.
+var extLanguages = func() map[string]string {
+	langs := make([]string, 0, len(languageExts))
+	for lang := range languageExts {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	m := make(map[string]string)
+	for _, lang := range langs {
+		for _, ext := range languageExts[lang] {
+			if _, ok := m[ext]; !ok {
+				m[ext] = lang
+			}
+		}
+	}
+	return m
+}()
+
+// languageOf returns the language (a languageExts key, accepted by the language parameter) for path, or "".
+// Like the language filter it compares extensions case-sensitively.
+func languageOf(path string) string {
+	return extLanguages[filepath.Ext(path)]
+}
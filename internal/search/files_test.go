@@ -0,0 +1,24 @@
+package search
+
+import "testing"
+
+// TestLanguageOf: the language find_files reports for a file selects that file again as a language filter.
+func TestLanguageOf(t *testing.T) {
+	for lang, exts := range languageExts {
+		for _, ext := range exts {
+			path := "src/x" + ext
+			got := languageOf(path)
+			if !hasLanguageExt(path, languageExtensions(got)) {
+				t.Errorf("%s: language %q does not select it (listed under %q)", path, got, lang)
+			}
+		}
+	}
+	for path, want := range map[string]string{
+		"a.c": "c", "a.h": "c", "a.hxx": "cpp", "a.py": "python", "a.tsx": "typescript", "a.mjs": "javascript",
+		"a.yml": "yaml", "a.json": "json", "a.sh": "sh", "a.scala": "scala", "a.GO": "", "Makefile": "",
+	} {
+		if got := languageOf(path); got != want {
+			t.Errorf("languageOf(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package search
+
+import (
+	"bytes"
+	"path/filepath"
+)
+
+// generatedHeaderLines is how many leading lines are checked for a generated-file marker; license headers
+// usually come first.
+const generatedHeaderLines = 40
+
+// lockFiles are dependency lock files, generated by package managers.
+var lockFiles = map[string]bool{
+	"package-lock.json":   true,
+	"npm-shrinkwrap.json": true,
+	"yarn.lock":           true,
+	"pnpm-lock.yaml":      true,
+	"bun.lock":            true,
+	"bun.lockb":           true,
+	"go.sum":              true,
+	"Cargo.lock":          true,
+	"Gemfile.lock":        true,
+	"composer.lock":       true,
+	"poetry.lock":         true,
+	"Pipfile.lock":        true,
+	"uv.lock":             true,
+	"mix.lock":            true,
+	"pubspec.lock":        true,
+	"Podfile.lock":        true,
+	"flake.lock":          true,
+	"packages.lock.json":  true,
+	"gradle.lockfile":     true,
+}
+
+// isLockFile reports whether path names a dependency lock file.
+func isLockFile(path string) bool {
+	return lockFiles[filepath.Base(path)]
+}
+
+// isBinaryHead reports whether the head of a file contains a NUL byte, the check rg and git use to tell
+// binary files apart.
+func isBinaryHead(head []byte) bool {
+	return bytes.IndexByte(head, 0) >= 0
+}
+
+// isGeneratedHead reports whether one of the first generatedHeaderLines lines of head carries a generated-file
+// marker: Go's "Code generated ... DO NOT EDIT." (in any comment syntax) or "@generated".
+func isGeneratedHead(head []byte) bool {
+	for i := 0; i < generatedHeaderLines && len(head) > 0; i++ {
+		line := head
+		if n := bytes.IndexByte(head, '\n'); n >= 0 {
+			line, head = head[:n], head[n+1:]
+		} else {
+			head = nil
+		}
+		if bytes.Contains(line, []byte("@generated")) {
+			return true
+		}
+		if k := bytes.Index(line, []byte("Code generated ")); k >= 0 && bytes.Contains(line[k:], []byte("DO NOT EDIT")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package search
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// isGlob reports whether pattern uses glob syntax; otherwise callers treat it as a plain substring.
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[{")
+}
+
+// compileGlob compiles a glob to an anchored regexp over slash-separated relative paths:
+// * and ? do not cross '/', ** matches across directories (a/**/b also matches a/b), [abc] / [!a-z] are
+// character classes and {a,b} alternatives. fold makes the match case-insensitive.
+func compileGlob(pattern string, fold bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if fold {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	depth := 0 // open { groups
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				switch {
+				case i+1 < len(pattern) && pattern[i+1] == '/':
+					i++
+					b.WriteString("(?:.*/)?")
+				default:
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == 0 { // []...] : ']' first in the class is literal
+				if e := strings.IndexByte(pattern[i+2:], ']'); e >= 0 {
+					end = e + 1
+				} else {
+					end = -1
+				}
+			}
+			if end < 0 {
+				return nil, &QueryError{Code: "invalid_glob", Message: "unclosed [ in glob", Query: pattern}
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '{':
+			depth++
+			b.WriteString("(?:")
+		case '}':
+			if depth == 0 {
+				b.WriteString(`\}`)
+				continue
+			}
+			depth--
+			b.WriteString(")")
+		case ',':
+			if depth > 0 {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	if depth > 0 {
+		return nil, &QueryError{Code: "invalid_glob", Message: "unclosed { in glob", Query: pattern}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, &QueryError{Code: "invalid_glob", Message: err.Error(), Query: pattern}
+	}
+	return re, nil
+}
+
+// pathFilter restricts the files of a search by their slash-separated path relative to the directory root:
+// path_hint is a substring of the path, include / exclude globs follow rg -g: a glob without '/' matches any
+// path component (the file name, or a directory for excludes), one with '/' the whole path from the root;
+// a trailing '/' restricts an exclude to directories. A file must match some include (if any) and no exclude.
+type pathFilter struct {
+	hint             string
+	include, exclude []pathGlob
+	rgGlobs          []string
+}
+
+type pathGlob struct {
+	re       *regexp.Regexp
+	anchored bool // contains '/': matched against the whole relative path
+	dirOnly  bool
+}
+
+// newPathFilter compiles the path filters; it returns nil when there are none.
+func newPathFilter(hint string, include, exclude []string) (*pathFilter, error) {
+	hint = strings.TrimSpace(filepath.ToSlash(hint))
+	if hint == "" && len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	f := &pathFilter{hint: hint}
+	for _, g := range include {
+		// an include of a directory (src/) means the files below it
+		if g = strings.TrimSpace(filepath.ToSlash(g)); strings.HasSuffix(g, "/") {
+			g += "**"
+		}
+		if err := f.add(&f.include, g, ""); err != nil {
+			return nil, err
+		}
+	}
+	for _, g := range exclude {
+		if err := f.add(&f.exclude, strings.TrimSpace(filepath.ToSlash(g)), "!"); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *pathFilter) add(list *[]pathGlob, g, rgPrefix string) error {
+	if g == "" {
+		return nil
+	}
+	pg := pathGlob{dirOnly: strings.HasSuffix(g, "/")}
+	pat := strings.TrimSuffix(g, "/")
+	pg.anchored = strings.Contains(pat, "/")
+	re, err := compileGlob(strings.TrimPrefix(pat, "/"), false)
+	if err != nil {
+		return err
+	}
+	pg.re = re
+	*list = append(*list, pg)
+	f.rgGlobs = append(f.rgGlobs, "-g", rgPrefix+g)
+	return nil
+}
+
+// match reports whether the glob matches rel or, for unanchored globs, its last component.
+func (g pathGlob) match(rel string) bool {
+	if g.anchored {
+		return g.re.MatchString(rel)
+	}
+	return g.re.MatchString(rel[strings.LastIndex(rel, "/")+1:])
+}
+
+// skipDir reports whether a directory (relative path) is excluded, so the walker need not enter it.
+func (f *pathFilter) skipDir(rel string) bool {
+	if f == nil || rel == "." {
+		return false
+	}
+	for _, g := range f.exclude {
+		if g.match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// keep reports whether a file (relative path) passes the path hint and the globs. Directories excluded along
+// the way are checked too, since rg output is filtered with keep alone.
+func (f *pathFilter) keep(rel string) bool {
+	if f == nil {
+		return true
+	}
+	if f.hint != "" && !strings.Contains("/"+rel, f.hint) {
+		return false
+	}
+	for i := strings.IndexByte(rel, '/'); i >= 0; i = nextSlash(rel, i) {
+		if f.skipDir(rel[:i]) {
+			return false
+		}
+	}
+	for _, g := range f.exclude {
+		if !g.dirOnly && g.match(rel) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, g := range f.include {
+		if g.match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// rgArgs returns the globs as rg -g arguments (excludes as !glob).
+func (f *pathFilter) rgArgs() []string {
+	if f == nil {
+		return nil
+	}
+	return f.rgGlobs
+}
+
+func nextSlash(s string, i int) int {
+	if j := strings.IndexByte(s[i+1:], '/'); j >= 0 {
+		return i + 1 + j
+	}
+	return -1
+}
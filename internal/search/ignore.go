@@ -1,76 +1,229 @@
 package search
 
 import (
-	"path/filepath"
+	"regexp"
 	"strings"
 )
 
-// fixed patterns always applied (like .git, node_modules, target, vendor)
+// fixed patterns always applied (.git, node_modules). Build output such as target/ and vendor/ is left to the
+// ignore files (DefaultIgnoreContent lists them), so a directory's own rules can re-include it.
 var fixedIgnoreDirs = map[string]bool{
-	".git": true, "node_modules": true, "target": true, "vendor": true,
+	".git": true, "node_modules": true,
 }
 
-// IgnoreRules parses gitignore-style content into a list of patterns.
-// Each non-empty, non-comment line is a pattern (glob or path segment).
+// fixedIgnoreRules stand for fixedIgnoreDirs when a rule is reported (dirIgnores.decide).
+var fixedIgnoreRules = func() map[string]*IgnoreRule {
+	m := make(map[string]*IgnoreRule, len(fixedIgnoreDirs))
+	for name := range fixedIgnoreDirs {
+		m[name] = &IgnoreRule{Pattern: name, Source: "fixed"}
+	}
+	return m
+}()
+
+// IgnoreRule is one pattern of a gitignore-style file.
+type IgnoreRule struct {
+	Pattern string `json:"pattern"` // the line as written, trailing spaces removed
+	Source  string `json:"source"`  // file (or other origin) the rule comes from
+	Line    int    `json:"line"`
+	Negate  bool   `json:"negate"` // "!pattern": re-includes what an earlier rule excluded
+
+	dirOnly bool           // trailing '/': matches directories only
+	re      *regexp.Regexp // over the slash-separated path relative to the search root
+}
+
+// IgnoreRules is a parsed gitignore-style file. Matching follows gitignore: the last matching rule decides,
+// "!" negates, a pattern with a '/' (other than trailing) is anchored to the search root and otherwise
+// matches at any depth, a trailing '/' matches directories only, * ? and [...] do not match '/', and **
+// spans directories in "**/x", "x/**" and "x/**/y". A path under an excluded directory stays excluded.
 type IgnoreRules struct {
-	patterns []string // trimmed, non-empty, not comment
+	rules []IgnoreRule
 }
 
-// ParseIgnoreRules parses raw gitignore-style content.
-func ParseIgnoreRules(data []byte) *IgnoreRules {
+// ParseIgnoreRules parses raw gitignore-style content; source names it in the rules (see IgnoreRule).
+// Lines that are not valid patterns (e.g. an unclosed [) never match, as in git.
+func ParseIgnoreRules(data []byte, source string) *IgnoreRules {
 	r := &IgnoreRules{}
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
+	for i, line := range strings.Split(string(data), "\n") {
+		rule, ok := parseIgnoreLine(line)
+		if !ok {
 			continue
 		}
-		r.patterns = append(r.patterns, line)
+		rule.Source, rule.Line = source, i+1
+		r.rules = append(r.rules, rule)
 	}
 	return r
 }
 
-// ShouldIgnore returns true if path (relative to search root or absolute) should be ignored.
-// isDir: true for directory, false for file.
-// Supports: "name", "path/name", "*.ext", "*/.name".
-func (r *IgnoreRules) ShouldIgnore(path string, isDir bool) bool {
-	path = filepath.ToSlash(path)
-	base := filepath.Base(path)
+func parseIgnoreLine(line string) (IgnoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// trailing spaces are ignored unless escaped with a backslash
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return IgnoreRule{}, false
+	}
+	rule := IgnoreRule{Pattern: line}
+	pat := line
+	if strings.HasPrefix(pat, "!") {
+		rule.Negate, pat = true, pat[1:]
+	}
+	if strings.HasSuffix(pat, "/") {
+		rule.dirOnly, pat = true, strings.TrimSuffix(pat, "/")
+	}
+	anchored := strings.Contains(pat, "/")
+	pat = strings.TrimPrefix(pat, "/")
+	if pat == "" {
+		return IgnoreRule{}, false
+	}
+	expr, ok := translateIgnoreGlob(pat)
+	if !ok {
+		return IgnoreRule{}, false
+	}
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return IgnoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
 
-	// Fixed dirs: any path segment matching .git, node_modules, target, vendor
-	for _, part := range strings.Split(path, "/") {
-		if fixedIgnoreDirs[part] {
-			return true
+// translateIgnoreGlob turns a gitignore glob into a regexp (git's wildmatch with WM_PATHNAME). Unlike rg -g
+// globs (compileGlob), {a,b} is literal and ** only spans directories next to a '/' or at an end.
+func translateIgnoreGlob(pat string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(pat); i++ {
+		c := pat[i]
+		switch c {
+		case '*':
+			if i+1 < len(pat) && pat[i+1] == '*' {
+				start := i
+				for i+1 < len(pat) && pat[i+1] == '*' {
+					i++
+				}
+				atStart := start == 0 || pat[start-1] == '/'
+				switch {
+				case atStart && i+1 < len(pat) && pat[i+1] == '/':
+					i++
+					b.WriteString("(?:.*/)?")
+				case atStart && i+1 == len(pat):
+					b.WriteString(".*")
+				default:
+					b.WriteString("[^/]*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			class, n, ok := translateIgnoreClass(pat[i+1:])
+			if !ok {
+				return "", false
+			}
+			b.WriteString(class)
+			i += n
+		case '\\':
+			if i+1 == len(pat) {
+				return "", false
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(pat[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(pat[i : i+1]))
 		}
 	}
+	return b.String(), true
+}
 
-	for _, pat := range r.patterns {
-		pat = filepath.ToSlash(strings.TrimSpace(pat))
-		if pat == "" {
-			continue
-		}
-		// Glob: *.ext, *.*, etc.
-		if strings.Contains(pat, "*") {
-			ok, _ := filepath.Match(pat, base)
-			if ok {
-				return true
+// translateIgnoreClass translates the bracket expression after '[' (s) and returns it with the number of
+// bytes of s it used. Negation is [!...] or [^...], ']' first in the class is literal, [:alpha:] and other
+// POSIX classes are kept; the class never matches '/'.
+func translateIgnoreClass(s string) (string, int, bool) {
+	var b strings.Builder
+	b.WriteString("[")
+	i := 0
+	if i < len(s) && (s[i] == '!' || s[i] == '^') {
+		b.WriteString("^/")
+		i++
+	}
+	for first := true; i < len(s); first = false {
+		c := s[i]
+		escaped := false
+		switch {
+		case c == ']' && !first:
+			b.WriteString("]")
+			return b.String(), i + 1, true
+		case c == '[' && strings.HasPrefix(s[i:], "[:"):
+			end := strings.Index(s[i+2:], ":]")
+			if end < 0 {
+				return "", 0, false
 			}
-			// Also try matching full path suffix (e.g. "**/*.log" -> match "*.log" on base)
-			if strings.HasPrefix(pat, "**/") {
-				ok, _ = filepath.Match(pat[3:], base)
-				if ok {
-					return true
-				}
+			b.WriteString(s[i : i+2+end+2])
+			i += 2 + end + 2
+			continue
+		case c == '\\':
+			if i+1 == len(s) {
+				return "", 0, false
 			}
+			i++
+			c, escaped = s[i], true
+		}
+		i++
+		switch {
+		case c == '/':
+		case c == '-' && !escaped && !first && i < len(s) && s[i] != ']':
+			b.WriteByte('-') // range
+		case strings.IndexByte(`\[]^-`, c) >= 0:
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, false
+}
+
+// Match returns the rule that decides rel (relative to the search root, slash-separated): the last matching
+// one, which may be a negation. It returns nil when no rule matches. Parent directories are not checked.
+func (r *IgnoreRules) Match(rel string, isDir bool) *IgnoreRule {
+	for i := len(r.rules) - 1; i >= 0; i-- {
+		rule := &r.rules[i]
+		if rule.dirOnly && !isDir {
 			continue
 		}
-		// Dir pattern: "dir" or "dir/" -> path contains "dir" as segment
-		if strings.HasSuffix(pat, "/") {
-			pat = pat[:len(pat)-1]
+		if rule.re.MatchString(rel) {
+			return rule
 		}
-		if strings.Contains(path, "/"+pat+"/") || strings.HasSuffix(path, "/"+pat) || path == pat || base == pat {
+	}
+	return nil
+}
+
+// excluded reports whether rel itself is excluded: a fixed directory name or a matching rule that is not a
+// negation. Walkers that skip excluded directories need no more than this.
+func (r *IgnoreRules) excluded(rel string, isDir bool) bool {
+	if rel == "." || rel == "" {
+		return false
+	}
+	if fixedIgnoreDirs[rel[strings.LastIndex(rel, "/")+1:]] {
+		return true
+	}
+	m := r.Match(rel, isDir)
+	return m != nil && !m.Negate
+}
+
+// ShouldIgnore returns true if rel (relative to the search root, slash-separated) is excluded, or lies under an
+// excluded directory. isDir: true for directory, false for file.
+func (r *IgnoreRules) ShouldIgnore(rel string, isDir bool) bool {
+	for i := strings.IndexByte(rel, '/'); i >= 0; i = nextSlash(rel, i) {
+		if r.excluded(rel[:i], true) {
 			return true
 		}
 	}
-	return false
+	return r.excluded(rel, isDir)
 }
@@ -0,0 +1,99 @@
+package search
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ignoreCases pair gitignore content with paths to check (a trailing '/' marks a directory). Each path is
+// decided by IgnoreRules.ShouldIgnore and by git check-ignore, which must agree.
+var ignoreCases = []struct {
+	name  string
+	rules string
+	paths []string
+}{
+	{"basename at any depth", "*.log\n", []string{"a.log", "x/y/b.log", "a.logx", "log/"}},
+	{"negation", "*.log\n!keep.log\n", []string{"a.log", "b.LOG", "keep.log", "sub/keep.log"}},
+	{"negation order", "!keep.log\n*.log\n", []string{"keep.log"}},
+	{"negation under excluded dir", "build/\n!build/keep.txt\n", []string{"build/keep.txt", "build/other.txt"}},
+	{"anchored with leading slash", "/build\n", []string{"build/", "build/x.go", "src/build/", "src/build/x.go"}},
+	{"anchored by inner slash", "docs/*.md\n", []string{"docs/a.md", "docs/sub/b.md", "x/docs/a.md"}},
+	{"directory only", "dist/\n", []string{"dist/", "dist/a.js", "x/dist/", "y/dist"}},
+	{"leading double star", "**/cache\n", []string{"cache/", "a/b/cache/", "a/cache", "cached"}},
+	{"trailing double star", "out/**\n", []string{"out/a", "out/b/c", "outx/a"}},
+	{"inner double star", "a/**/b\n", []string{"a/b", "a/x/b", "a/x/y/b", "x/a/b"}},
+	{"double star both sides", "**/deep/**/x.c\n", []string{"deep/x.c", "p/deep/q/r/x.c", "deep/x.h"}},
+	{"double star inside name", "src/**gen\n", []string{"src/gen", "src/xgen", "src/a/gen"}},
+	{"star does not cross slash", "lib/*/tmp\n", []string{"lib/a/tmp", "lib/a/b/tmp"}},
+	{"question mark", "x?y\n", []string{"xay", "xy", "x/y/"}},
+	{"character class", "*.[oa]\n", []string{"m.o", "m.a", "m.c"}},
+	{"negated class", "file[!0-9].txt\n", []string{"filea.txt", "file1.txt"}},
+	{"caret class", "file[^0-9].txt\n", []string{"fileb.txt", "file2.txt"}},
+	{"range and case", "[Bb]in/\n", []string{"bin/", "Bin/", "cin/"}},
+	{"posix class", "abc[[:digit:]]\n", []string{"abc1", "abcx"}},
+	{"bracket first in class", "a[]]b\n", []string{"a]b", "ab"}},
+	{"braces are literal", "*.{js,ts}\n", []string{"a.js", "a.{js,ts}"}},
+	{"escaped hash and bang", "\\#hash\n\\!bang\n", []string{"#hash", "!bang"}},
+	{"comment", "# a.txt\n", []string{"# a.txt", "a.txt"}},
+	{"trailing spaces trimmed", "trailing   \n", []string{"trailing"}},
+	{"escaped trailing space", "esc\\ \n", []string{"esc ", "esc"}},
+	{"escaped star", "a\\*\n", []string{"a*", "ab"}},
+	{"dir re-included", "sub/\n!sub/\n", []string{"sub/", "sub/a"}},
+	{"crlf", "a.txt\r\n", []string{"a.txt"}},
+}
+
+// TestIgnoreRulesMatchGit checks the gitignore translation against git check-ignore. Skipped without git.
+func TestIgnoreRulesMatchGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	for _, tc := range ignoreCases {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+				t.Fatalf("git init: %v %s", err, out)
+			}
+			if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte(tc.rules), 0644); err != nil {
+				t.Fatal(err)
+			}
+			var rels []string
+			for _, p := range tc.paths {
+				rel := strings.TrimSuffix(p, "/")
+				abs := filepath.Join(root, filepath.FromSlash(rel))
+				var err error
+				if strings.HasSuffix(p, "/") {
+					err = os.MkdirAll(abs, 0755)
+				} else if err = os.MkdirAll(filepath.Dir(abs), 0755); err == nil {
+					err = os.WriteFile(abs, nil, 0644)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				rels = append(rels, rel)
+			}
+			cmd := exec.Command("git", "check-ignore", "--no-index", "--stdin", "-z")
+			cmd.Dir = root
+			// the user's core.excludesFile must not take part
+			cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1")
+			cmd.Stdin = strings.NewReader(strings.Join(rels, "\x00") + "\x00")
+			out, err := cmd.Output()
+			if exit, ok := err.(*exec.ExitError); err != nil && !(ok && exit.ExitCode() == 1) {
+				t.Fatalf("git check-ignore: %v", err)
+			}
+			gitIgnored := make(map[string]bool)
+			for _, rel := range strings.Split(string(out), "\x00") {
+				gitIgnored[rel] = true
+			}
+			rules := ParseIgnoreRules([]byte(tc.rules), ".gitignore")
+			for i, p := range tc.paths {
+				got := rules.ShouldIgnore(rels[i], strings.HasSuffix(p, "/"))
+				if got != gitIgnored[rels[i]] {
+					t.Errorf("%q with %q: ignored=%v, git says %v", rels[i], tc.rules, got, gitIgnored[rels[i]])
+				}
+			}
+		})
+	}
+}
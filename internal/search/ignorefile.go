@@ -0,0 +1,135 @@
+package search
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ignoreReloadDelay lets a burst of file events (an editor truncating then writing, or a save followed by its
+// own fsnotify event) settle into a single reload.
+const ignoreReloadDelay = 100 * time.Millisecond
+
+// ignoreFiles holds the managers of the global ignore files by absolute path.
+var ignoreFiles = struct {
+	sync.Mutex
+	m map[string]*IgnoreFile
+}{m: make(map[string]*IgnoreFile)}
+
+// IgnoreFile is the global ignore file (-ignore-file-path) with its parsed rules, shared by every search.
+// Searches never read the file themselves: it is loaded once, then reloaded after a save through the admin
+// API (Reload) and whenever it changes on disk (Watch). Version increases each time the rules change.
+type IgnoreFile struct {
+	path string // as configured; names the rules' source
+	abs  string
+
+	mu      sync.RWMutex
+	data    []byte
+	exists  bool
+	rules   *IgnoreRules
+	version uint64
+}
+
+// GlobalIgnore returns the manager of the ignore file at path, loading it on first use. A missing file gives
+// the fixed rules only; the file is never created here.
+func GlobalIgnore(path string) *IgnoreFile {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = filepath.Clean(path)
+	}
+	ignoreFiles.Lock()
+	defer ignoreFiles.Unlock()
+	f := ignoreFiles.m[abs]
+	if f == nil {
+		f = &IgnoreFile{path: path, abs: abs}
+		f.Reload()
+		ignoreFiles.m[abs] = f
+	}
+	return f
+}
+
+// Rules returns the current rules. They are never modified, so callers may keep them for a whole search.
+func (f *IgnoreFile) Rules() *IgnoreRules {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.rules
+}
+
+// Version returns the version of the current rules, starting at 1 for the first load.
+func (f *IgnoreFile) Version() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.version
+}
+
+// Exists reports whether the file existed at the last load.
+func (f *IgnoreFile) Exists() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.exists
+}
+
+// Reload re-reads the file and returns the version of the rules. The version only moves when the content
+// (or the file's presence) changed, so reloading twice for one save costs nothing.
+func (f *IgnoreFile) Reload() uint64 {
+	data, err := os.ReadFile(f.abs)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("[ignore] 读取忽略文件失败 %s: %v", f.path, err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rules != nil && exists == f.exists && bytes.Equal(data, f.data) {
+		return f.version
+	}
+	f.data, f.exists = data, exists
+	f.rules = ParseIgnoreRules(data, f.path)
+	f.version++
+	if f.version > 1 {
+		log.Printf("[ignore] 忽略规则已重新加载 %s (version %d, %d rules)", f.path, f.version, len(f.rules.rules))
+	}
+	return f.version
+}
+
+// Watch reloads the rules whenever the file is written, created, renamed or removed. The parent directory is
+// watched rather than the file, so editors that save by renaming a new file over the old one are followed.
+func (f *IgnoreFile) Watch() error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := w.Add(filepath.Dir(f.abs)); err != nil {
+		_ = w.Close()
+		return err
+	}
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) != f.abs || ev.Op == fsnotify.Chmod {
+					continue
+				}
+				if timer == nil {
+					timer = time.AfterFunc(ignoreReloadDelay, func() { f.Reload() })
+				} else {
+					timer.Reset(ignoreReloadDelay)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("[ignore] watch %s: %v", f.path, err)
+			}
+		}
+	}()
+	return nil
+}
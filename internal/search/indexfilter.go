@@ -0,0 +1,105 @@
+package search
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+	"github.com/qiuxsgit/codex-mcp/internal/index"
+)
+
+// RefreshIndex incrementally rebuilds the trigram index of d in the background.
+// No-op when the index is disabled (rg installed).
+func RefreshIndex(d db.Directory) {
+	if !index.Enabled() {
+		return
+	}
+	index.RefreshAsync(d.ID, filepath.Clean(d.Path), skipIndexDir)
+}
+
+// refreshStaleIndex is RefreshIndex for a search that found the index missing or stale; rate-limited per directory.
+func refreshStaleIndex(d db.Directory) {
+	index.RefreshStale(d.ID, filepath.Clean(d.Path), skipIndexDir)
+}
+
+func skipIndexDir(rel string) bool {
+	return fixedIgnoreDirs[rel[strings.LastIndex(rel, "/")+1:]]
+}
+
+// candidateFilter returns a predicate reporting whether a file under d may match q, based on the trigram index.
+// Files missing from the index or changed since it was built (size/mtime) are always scanned, and trigger a
+// background refresh (at most one per directory every 30s, see index.RefreshStale). Returns nil when there is
+// no usable index or q gives no trigram constraint.
+func candidateFilter(q *query, d db.Directory) func(rel string, info fs.FileInfo) bool {
+	ix := index.Get(d.ID, filepath.Clean(d.Path))
+	if ix == nil {
+		refreshStaleIndex(d)
+		return nil
+	}
+	ids, all := queryCandidates(ix, q)
+	if all {
+		return nil
+	}
+	var staleOnce sync.Once
+	return func(rel string, info fs.FileInfo) bool {
+		id, ok := ix.Lookup(rel, info.Size(), info.ModTime())
+		if !ok {
+			staleOnce.Do(func() { refreshStaleIndex(d) })
+			return true
+		}
+		return ids[id]
+	}
+}
+
+// queryCandidates combines the per-term candidates of q: intersection over "and" terms, union over "or" terms.
+// "not" terms cannot narrow the set. all is true when no term constrains the result.
+func queryCandidates(ix *index.Index, q *query) (ids map[uint32]bool, all bool) {
+	all = true
+	for _, m := range q.and {
+		cand, any := ix.Candidates(m.literals, m.fold)
+		if any {
+			continue
+		}
+		if all {
+			ids, all = cand, false
+			continue
+		}
+		for id := range ids {
+			if !cand[id] {
+				delete(ids, id)
+			}
+		}
+	}
+	if len(q.or) > 0 {
+		union := make(map[uint32]bool)
+		for _, m := range q.or {
+			cand, any := ix.Candidates(m.literals, m.fold)
+			if any {
+				return ids, all
+			}
+			for id := range cand {
+				union[id] = true
+			}
+		}
+		if all {
+			return union, false
+		}
+		for id := range ids {
+			if !union[id] {
+				delete(ids, id)
+			}
+		}
+	}
+	return ids, all
+}
+
+// relSlash returns path relative to root with forward slashes.
+func relSlash(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
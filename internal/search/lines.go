@@ -0,0 +1,56 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// lineReader splits a file into lines of any length. bufio.Scanner stops at the first line longer than its
+// 64KB token limit, which would silently drop every later match of a minified file.
+type lineReader struct {
+	r   *bufio.Reader
+	buf []byte
+	err error
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// next returns the next line without its "\n" or "\r\n" ending; ok is false at the end of the file or on a
+// read error (see Err).
+func (lr *lineReader) next() (string, bool) {
+	lr.buf = lr.buf[:0]
+	for {
+		chunk, err := lr.r.ReadSlice('\n')
+		lr.buf = append(lr.buf, chunk...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				lr.err = err
+			}
+			if len(lr.buf) == 0 {
+				return "", false
+			}
+		}
+		break
+	}
+	line := bytes.TrimSuffix(lr.buf, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return string(line), true
+}
+
+// head returns up to the first n bytes of the file without consuming them; call it before next.
+func (lr *lineReader) head(n int) []byte {
+	b, _ := lr.r.Peek(n)
+	return b
+}
+
+// Err returns the read error that ended the file, if any.
+func (lr *lineReader) Err() error {
+	return lr.err
+}
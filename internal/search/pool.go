@@ -0,0 +1,102 @@
+package search
+
+import (
+	"runtime"
+	"sync"
+)
+
+// scanFiles runs searchFile over the files emitted by produce on a bounded pool of workers
+// (one producer, N scanners; N = p.Workers, or GOMAXPROCS when <= 0).
+//
+// Results are assembled in emit order, so the output is deterministic no matter which worker finishes first.
+// Once limit matches or maxBytes of output are collected, produce is told to stop (emit returns false)
+// and files not yet scanned are skipped.
+func scanFiles(q *query, p Params, produce func(emit func(scanTarget) bool)) []Match {
+	workers, limit, maxBytes := p.Workers, p.Limit, p.maxBytes
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	type job struct {
+		seq    int
+		target scanTarget
+	}
+	type result struct {
+		seq     int
+		matches []Match
+	}
+	jobs := make(chan job, workers*4)
+	results := make(chan result, workers*4)
+	done := make(chan struct{})
+	var closeDone sync.Once
+	stop := func() { closeDone.Do(func() { close(done) }) }
+	defer stop()
+
+	go func() {
+		defer close(jobs)
+		seq := 0
+		produce(func(t scanTarget) bool {
+			select {
+			case jobs <- job{seq: seq, target: t}:
+				seq++
+				return true
+			case <-done:
+				return false
+			}
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				var ms []Match
+				select {
+				case <-done:
+				default:
+					// Each file is capped at the full budget: the collector trims in order,
+					// which keeps the result independent of scheduling.
+					ms = searchFile(j.target, q, p)
+				}
+				results <- result{seq: j.seq, matches: ms}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var matches []Match
+	totalBytes := 0
+	pending := make(map[int][]Match)
+	next := 0
+	full := false
+	for r := range results {
+		if full {
+			continue // drain so workers can exit
+		}
+		pending[r.seq] = r.matches
+		for !full {
+			ms, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			for _, m := range ms {
+				if len(matches) >= limit || totalBytes >= maxBytes {
+					break
+				}
+				matches = append(matches, m)
+				totalBytes += len(m.Path) + len(m.Snippet) + 64
+			}
+			if len(matches) >= limit || totalBytes >= maxBytes {
+				full = true
+				stop()
+			}
+		}
+	}
+	return matches
+}
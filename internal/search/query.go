@@ -0,0 +1,366 @@
+package search
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query modes accepted by Params.Mode.
+const (
+	ModeLiteral = "literal" // 默认：按字面量匹配
+	ModeRegex   = "regex"   // Go RE2 正则，两种引擎语义一致
+)
+
+// Case-sensitivity values accepted by Params.Case. Both engines apply them identically.
+const (
+	CaseSensitive   = "sensitive"
+	CaseInsensitive = "insensitive"
+	CaseSmart       = "smart" // 默认：查询中含大写字母时区分大小写，否则不区分
+)
+
+// Term operators for Params.Terms.
+const (
+	OpAnd = "and"
+	OpOr  = "or"
+	OpNot = "not"
+)
+
+// Term is one entry of a boolean multi-term query. Operators combine at file level: a file matches when it
+// contains every "and" term, at least one "or" term (if there are any), and none of the "not" terms.
+type Term struct {
+	Text string `json:"text"`
+	Op   string `json:"op"` // and（默认）/ or / not
+}
+
+// QueryError is returned for invalid query input (bad mode, regex that does not compile, ...).
+// Callers can surface it as a structured tool error instead of a generic failure.
+type QueryError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Query   string `json:"query,omitempty"`
+}
+
+func (e *QueryError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// matcher is the single source of truth for "does this line match".
+// The rg backend only uses rgArgs as a prefilter; every line it reports is re-checked with re,
+// so rg and the built-in engine return the same matches even where Rust regex and RE2 differ.
+type matcher struct {
+	re       *regexp.Regexp
+	isWord   func(rune) bool // non-nil: whole-word matching, a hit must not touch a word character on either side
+	literals []string        // every matching line contains one of these; nil if none could be derived
+	fold     bool            // literals must be compared case-insensitively
+	rgArgs   []string        // pattern arguments for rg; nil means rg cannot prefilter this query
+}
+
+// compileMatcher validates the query and builds a matcher for p.Mode and p.Case.
+func compileMatcher(p Params) (*matcher, error) {
+	switch p.Case {
+	case "", CaseSmart, CaseSensitive, CaseInsensitive:
+	default:
+		return nil, &QueryError{Code: "invalid_case", Message: "case must be sensitive, insensitive or smart", Query: p.Query}
+	}
+	switch p.Mode {
+	case "", ModeLiteral:
+		fold := foldCase(p.Case, hasUpper(p.Query))
+		re, err := regexp.Compile(caseFlag(fold) + regexp.QuoteMeta(p.Query))
+		if err != nil {
+			return nil, err
+		}
+		m := &matcher{re: re, isWord: wordFunc(p), literals: []string{p.Query}, fold: fold, rgArgs: []string{"-F", rgCaseArg(fold)}}
+		if m.isWord != nil {
+			m.rgArgs = append(m.rgArgs, "-w")
+		}
+		m.rgArgs = append(m.rgArgs, "-e", p.Query)
+		return m, nil
+	case ModeRegex:
+		parsed, err := syntax.Parse(p.Query, syntax.Perl)
+		if err != nil {
+			return nil, &QueryError{Code: "invalid_regex", Message: err.Error(), Query: p.Query}
+		}
+		fold := foldCase(p.Case, regexHasUpper(parsed))
+		re, err := regexp.Compile(caseFlag(fold) + p.Query)
+		if err != nil {
+			return nil, &QueryError{Code: "invalid_regex", Message: err.Error(), Query: p.Query}
+		}
+		// 字面量始终不区分大小写地预过滤：正则内可能含 (?i)，由 re 做最终判断
+		m := &matcher{re: re, isWord: wordFunc(p), literals: requiredLiterals(parsed.Simplify()), fold: true}
+		if len(m.literals) > 0 {
+			m.rgArgs = []string{"-F", "-i"}
+			for _, l := range m.literals {
+				m.rgArgs = append(m.rgArgs, "-e", l)
+			}
+		}
+		return m, nil
+	default:
+		return nil, &QueryError{Code: "invalid_mode", Message: "mode must be literal or regex", Query: p.Query}
+	}
+}
+
+// query is a compiled boolean query. Params.Query, when set, is an implicit "and" term.
+// Every term shares the Mode / Case / WholeWord options of Params.
+type query struct {
+	and, or, not []*matcher
+}
+
+// compileQuery validates p.Query and p.Terms and compiles one matcher per term.
+func compileQuery(p Params) (*query, error) {
+	q := &query{}
+	terms := p.Terms
+	if p.Query != "" {
+		terms = append([]Term{{Text: p.Query, Op: OpAnd}}, terms...)
+	}
+	for _, t := range terms {
+		if t.Text == "" {
+			continue
+		}
+		tp := p
+		tp.Query = t.Text
+		m, err := compileMatcher(tp)
+		if err != nil {
+			return nil, err
+		}
+		switch normalizeOption(t.Op) {
+		case "", OpAnd:
+			q.and = append(q.and, m)
+		case OpOr:
+			q.or = append(q.or, m)
+		case OpNot:
+			q.not = append(q.not, m)
+		default:
+			return nil, &QueryError{Code: "invalid_term_op", Message: "term op must be and, or or not", Query: t.Text}
+		}
+	}
+	if len(q.and) == 0 && len(q.or) == 0 {
+		return nil, &QueryError{Code: "empty_query", Message: "query or at least one and/or term is required"}
+	}
+	return q, nil
+}
+
+// single returns the matcher when q is a plain one-term query, or nil for boolean queries.
+func (q *query) single() *matcher {
+	if len(q.and) == 1 && len(q.or) == 0 && len(q.not) == 0 {
+		return q.and[0]
+	}
+	return nil
+}
+
+// fileState tracks which terms of q a file has matched so far.
+type fileState struct {
+	q       *query
+	seenAnd []bool
+	seenOr  bool
+	negated bool
+}
+
+func (q *query) newFileState() *fileState {
+	return &fileState{q: q, seenAnd: make([]bool, len(q.and))}
+}
+
+// scanLine records the terms line matches and returns the byte ranges of its positive (and/or) hits,
+// in line order; nil when no positive term matched.
+func (s *fileState) scanLine(line string) [][]int {
+	for _, m := range s.q.not {
+		if m.Match(line) {
+			s.negated = true
+		}
+	}
+	var hits [][]int
+	for i, m := range s.q.and {
+		if locs := m.FindAll(line); len(locs) > 0 {
+			s.seenAnd[i] = true
+			hits = append(hits, locs...)
+		}
+	}
+	for _, m := range s.q.or {
+		if locs := m.FindAll(line); len(locs) > 0 {
+			s.seenOr = true
+			hits = append(hits, locs...)
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i][0] < hits[j][0] })
+	return hits
+}
+
+// satisfied reports whether the whole file matches the boolean query.
+func (s *fileState) satisfied() bool {
+	if s.negated {
+		return false
+	}
+	for _, ok := range s.seenAnd {
+		if !ok {
+			return false
+		}
+	}
+	return len(s.q.or) == 0 || s.seenOr
+}
+
+// foldCase resolves the case mode to "match case-insensitively or not".
+func foldCase(mode string, queryHasUpper bool) bool {
+	switch mode {
+	case CaseSensitive:
+		return false
+	case CaseInsensitive:
+		return true
+	default:
+		return !queryHasUpper
+	}
+}
+
+func caseFlag(fold bool) string {
+	if fold {
+		return "(?i)"
+	}
+	return ""
+}
+
+// rgCaseArg returns the explicit rg flag for fold; rg's own --smart-case is not used so both engines agree.
+func rgCaseArg(fold bool) string {
+	if fold {
+		return "-i"
+	}
+	return "-s"
+}
+
+func hasUpper(s string) bool {
+	for _, r := range s {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// regexHasUpper reports whether a literal part of re contains an uppercase letter.
+// Escapes and classes such as \W or \S do not count, same as rg's smart case.
+func regexHasUpper(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if unicode.IsUpper(r) {
+				return true
+			}
+		}
+		return false
+	default:
+		for _, sub := range re.Sub {
+			if regexHasUpper(sub) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Match reports whether line matches the query.
+func (m *matcher) Match(line string) bool {
+	if m.isWord == nil {
+		return m.re.MatchString(line)
+	}
+	return len(m.FindAll(line)) > 0
+}
+
+// FindAll returns the byte ranges of all hits in line, honoring whole-word boundaries.
+func (m *matcher) FindAll(line string) [][]int {
+	locs := m.re.FindAllStringIndex(line, -1)
+	if m.isWord == nil {
+		return locs
+	}
+	out := locs[:0]
+	for _, loc := range locs {
+		if loc[0] == loc[1] {
+			continue
+		}
+		before, _ := utf8.DecodeLastRuneInString(line[:loc[0]])
+		after, _ := utf8.DecodeRuneInString(line[loc[1]:])
+		if (loc[0] > 0 && m.isWord(before)) || (loc[1] < len(line) && m.isWord(after)) {
+			continue
+		}
+		out = append(out, loc)
+	}
+	return out
+}
+
+// wordFunc returns the word-character predicate for whole-word matching, or nil when it is off.
+// Identifier mode also treats '$' as part of a word (Java/JS identifiers), so "User" does not hit "$User".
+func wordFunc(p Params) func(rune) bool {
+	switch {
+	case p.Identifier:
+		return isIdentRune
+	case p.WholeWord:
+		return isWordRune
+	default:
+		return nil
+	}
+}
+
+// isWordRune matches rg's Unicode-aware \w, which -w uses for its boundaries.
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.M, r)
+}
+
+func isIdentRune(r rune) bool {
+	return r == '$' || isWordRune(r)
+}
+
+// requiredLiterals returns a set of literals such that every string matched by re contains at least one of them.
+// Returns nil when no such set can be derived (e.g. `\w+`). Case folding is ignored: callers must match the
+// literals case-insensitively. Literals spanning lines are left out: rg matches line by line and rejects them.
+func requiredLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if len(re.Rune) == 0 || strings.ContainsRune(string(re.Rune), '\n') {
+			return nil
+		}
+		return []string{string(re.Rune)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return nil
+		}
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpConcat:
+		var best []string
+		for _, sub := range re.Sub {
+			lits := requiredLiterals(sub)
+			if lits != nil && (best == nil || shortest(lits) > shortest(best)) {
+				best = lits
+			}
+		}
+		return best
+	case syntax.OpAlternate:
+		var out []string
+		for _, sub := range re.Sub {
+			lits := requiredLiterals(sub)
+			if lits == nil {
+				return nil
+			}
+			out = append(out, lits...)
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+func shortest(lits []string) int {
+	n := -1
+	for _, l := range lits {
+		if n < 0 || len(l) < n {
+			n = len(l)
+		}
+	}
+	return n
+}
+
+// normalizeOption lowercases and trims a user-supplied option value (mode, case, ...).
+func normalizeOption(v string) string {
+	return strings.ToLower(strings.TrimSpace(v))
+}
@@ -0,0 +1,32 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestRegexPrefilter: the literals handed to rg for a regex query are ones every match contains, never span
+// lines, and no prefilter is used when none can be derived.
+func TestRegexPrefilter(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		want  []string // rg pattern arguments
+	}{
+		{`func\s+Load`, []string{"-F", "-i", "-e", "func"}},
+		{`(Get|Set)User`, []string{"-F", "-i", "-e", "User"}},
+		{`foo|bar`, []string{"-F", "-i", "-e", "foo", "-e", "bar"}},
+		{`\w+`, nil},
+		{"a\nbc", nil},
+		{`x\nyz`, nil},
+		{"end\nof|other", nil},
+		{`(?s)ab.*\nlonger`, []string{"-F", "-i", "-e", "ab"}}, // the longer literal spans lines
+	} {
+		m, err := compileMatcher(Params{Query: tc.query, Mode: ModeRegex})
+		if err != nil {
+			t.Fatalf("%q: %v", tc.query, err)
+		}
+		if !reflect.DeepEqual(m.rgArgs, tc.want) {
+			t.Errorf("%q: rg args %q, want %q", tc.query, m.rgArgs, tc.want)
+		}
+	}
+}
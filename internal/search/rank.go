@@ -0,0 +1,142 @@
+package search
+
+import (
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+)
+
+// Sort orders accepted by Params.Sort.
+const (
+	SortRelevance = "relevance" // 默认：按得分排序
+	SortPath      = "path"      // 按目录、文件遍历顺序、行号
+)
+
+// Score weights. The base keeps scores positive for typical matches.
+const (
+	scoreBase       = 10.0
+	scoreDefinition = 10.0 // hit line defines the searched name (func X, class X, def X, ...)
+	scoreExactCase  = 1.0  // case-insensitive search, but the line has the query in its exact case
+	scoreWholeWord  = 1.0  // query occurs as a whole word
+	scoreTestFile   = -5.0 // _test.go, *.spec.ts, src/test/..., ...
+	scoreFixture    = -6.0 // testdata, fixtures, mocks
+	scoreDepth      = -0.5 // per directory level, capped at scoreDepthMax
+	scoreDepthMax   = -5.0
+	scoreDensityHit = 0.5 // per additional hit in the same file, capped at scoreDensityMax
+	scoreDensityMax = 2.0
+)
+
+// defPatterns capture the defined name on definition-like lines in common languages.
+var defPatterns = []*regexp.Regexp{
+	// func X / func (r *T) X / def X / class X / type X / fn X / function X / interface X / ...
+	regexp.MustCompile(`(?:^|[\s(])(?:func|def|class|interface|struct|enum|trait|type|fn|function|object|record|module|impl|protocol)\s+(?:\([^)]*\)\s*)?([\p{L}_$][\p{L}\p{N}_$]*)`),
+	// const X = / let X = / var X = / val X =
+	regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let|var|val)\s+([\p{L}_$][\p{L}\p{N}_$]*)\s*(?::[^=]*)?=`),
+	// Java / C# / Kotlin style methods: public static Foo<Bar> name(
+	regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|static|final|abstract|synchronized|override|async|virtual|open|suspend)\s+)+[\w<>\[\],.?\s]*?([\p{L}_$][\p{L}\p{N}_$]*)\s*\(`),
+}
+
+// pathRoles adjusts scores by directory role, matched against path segments.
+var pathRoles = map[string]float64{
+	"src": 1, "core": 1, "internal": 1, "pkg": 1, "lib": 1, "app": 1, "main": 1,
+	"docs": -3, "doc": -3, "example": -3, "examples": -3, "sample": -3, "samples": -3, "demo": -3, "benchmark": -3, "benchmarks": -3, "scripts": -2,
+	"generated": -4, "gen": -3, "dist": -4, "build": -4, "third_party": -4, "thirdparty": -4,
+}
+
+var fixtureDirs = map[string]bool{"testdata": true, "fixtures": true, "__fixtures__": true, "mocks": true, "__mocks__": true, "mock": true}
+var testDirs = map[string]bool{"test": true, "tests": true, "__tests__": true, "spec": true, "specs": true, "androidTest": true}
+
+// scoreMatches sets Match.Score from: definition-like hit lines, test/fixture files, path length,
+// directory role and match density (hits in the same file among matches).
+func scoreMatches(q *query, roots []db.Directory, matches []Match) {
+	perFile := make(map[string]int)
+	for _, m := range matches {
+		perFile[m.Path] += len(m.MatchLines)
+	}
+	positives := append(append([]*matcher{}, q.and...), q.or...)
+	for i := range matches {
+		m := &matches[i]
+		rel := m.Path
+		if m.dirIdx >= 0 && m.dirIdx < len(roots) {
+			rel = relSlash(filepath.Clean(roots[m.dirIdx].Path), m.Path)
+		}
+		s := scoreBase + scorePath(rel)
+		def, exact, word := false, false, false
+		for _, t := range m.texts { // a merged snippet scores as its best hit lines
+			def = def || isDefinitionOf(t, positives)
+			for _, pm := range positives {
+				exact = exact || pm.fold && pm.literals != nil && len(pm.literals) == 1 && strings.Contains(t, pm.literals[0])
+				word = word || pm.isWord == nil && hasWholeWord(pm, t)
+			}
+		}
+		if def {
+			s += scoreDefinition
+		}
+		if exact {
+			s += scoreExactCase
+		}
+		if word {
+			s += scoreWholeWord
+		}
+		s += math.Min(float64(perFile[m.Path]-1)*scoreDensityHit, scoreDensityMax)
+		m.Score = math.Round(s*100) / 100
+	}
+}
+
+// scorePath scores a slash-separated path relative to its root.
+func scorePath(rel string) float64 {
+	segs := strings.Split(rel, "/")
+	s := math.Max(float64(len(segs)-1)*scoreDepth, scoreDepthMax)
+	dirs, base := segs[:len(segs)-1], segs[len(segs)-1]
+	fixture, test := false, isTestFileName(base)
+	for _, d := range dirs {
+		s += pathRoles[d]
+		if fixtureDirs[d] {
+			fixture = true
+		}
+		if testDirs[d] {
+			test = true
+		}
+	}
+	switch {
+	case fixture:
+		s += scoreFixture
+	case test:
+		s += scoreTestFile
+	}
+	return s
+}
+
+func isTestFileName(base string) bool {
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	return strings.HasSuffix(stem, "_test") || strings.HasSuffix(stem, ".test") || strings.HasSuffix(stem, ".spec") ||
+		strings.HasPrefix(stem, "test_") || strings.HasSuffix(stem, "Test") || strings.HasSuffix(stem, "Tests")
+}
+
+// isDefinitionOf reports whether line defines a name that one of the matchers matches in full.
+func isDefinitionOf(line string, ms []*matcher) bool {
+	for _, re := range defPatterns {
+		for _, sub := range re.FindAllStringSubmatch(line, -1) {
+			name := sub[1]
+			for _, m := range ms {
+				for _, loc := range m.re.FindAllStringIndex(name, -1) {
+					if loc[0] == 0 && loc[1] == len(name) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// hasWholeWord reports whether m hits line somewhere as a whole word.
+func hasWholeWord(m *matcher, line string) bool {
+	wm := *m
+	wm.isWord = isWordRune
+	return len(wm.FindAll(line)) > 0
+}
@@ -0,0 +1,106 @@
+package search
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+)
+
+// TestRankedDefinitionFirst: a definition that comes after many other hits in path order is still ranked
+// first, and paging through the ranked results returns every match once.
+func TestRankedDefinitionFirst(t *testing.T) {
+	files := map[string]string{"zcore/user.go": "package zcore\n\nfunc LoadUser() {}\n"}
+	for i := 0; i < 120; i++ {
+		files[fmt.Sprintf("afixtures/case%03d.go", i)] = "package afixtures\n\nvar _ = LoadUser\n"
+	}
+	root := writeFixture(t, files)
+	roots := []db.Directory{{ID: 1, Name: "fixture", Path: root, UseVCSIgnore: true}}
+	p := Params{Query: "LoadUser", Sort: SortRelevance, Limit: 20}
+	q, err := compileQuery(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := searchRanked(p, q, roots, cleanPaths(roots), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Matches) == 0 || relSlash(root, res.Matches[0].Path) != "zcore/user.go" {
+		t.Fatalf("first match %+v, want the definition in zcore/user.go", res.Matches[:min(1, len(res.Matches))])
+	}
+
+	seen := make(map[string]bool)
+	for page := 0; ; page++ {
+		for _, m := range res.Matches {
+			key := fmt.Sprintf("%s:%d", m.Path, m.LineStart)
+			if seen[key] {
+				t.Fatalf("page %d repeats %s", page, key)
+			}
+			seen[key] = true
+		}
+		if res.NextCursor == "" {
+			break
+		}
+		from, err := decodeCursor(res.NextCursor, p, roots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, err = searchRanked(p, q, roots, cleanPaths(roots), from); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(seen) != 121 {
+		t.Errorf("paged through %d matches, want 121", len(seen))
+	}
+}
+
+// TestRankedWindowFromLimit: the relevance window scales with the page limit and stays the same for later
+// pages, even when they ask another limit; paging across windows still returns every match once.
+func TestRankedWindowFromLimit(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 120; i++ {
+		files[fmt.Sprintf("f%03d.go", i)] = "package p\n\nvar _ = Needle\n"
+	}
+	root := writeFixture(t, files)
+	roots := []db.Directory{{ID: 1, Name: "fixture", Path: root, UseVCSIgnore: true}}
+	p := Params{Query: "Needle", Sort: SortRelevance, Limit: 0}
+	q, err := compileQuery(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := rankPool(2); n != 2*rankPoolFactor {
+		t.Fatalf("rankPool(2) = %d", n)
+	}
+	if n := rankPool(1000); n != rankPoolSize {
+		t.Fatalf("rankPool(1000) = %d", n)
+	}
+
+	seen := make(map[string]bool)
+	var from *resume
+	for page, limit := 0, 1; ; page, limit = page+1, 7-limit { // limits 1, 6, 1, 6, ...
+		p.Limit = limit
+		res, err := searchRanked(p, q, roots, cleanPaths(roots), from)
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		for _, m := range res.Matches {
+			if seen[m.Path] {
+				t.Fatalf("page %d repeats %s", page, m.Path)
+			}
+			seen[m.Path] = true
+		}
+		if res.NextCursor == "" {
+			break
+		}
+		if from, err = decodeCursor(res.NextCursor, p, roots); err != nil {
+			t.Fatal(err)
+		}
+		if from.pool != rankPool(1) {
+			t.Fatalf("page %d: window %d, want the first page's %d", page, from.pool, rankPool(1))
+		}
+	}
+	if len(seen) != 120 {
+		t.Errorf("paged through %d matches, want 120", len(seen))
+	}
+}
@@ -0,0 +1,230 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+	"github.com/qiuxsgit/codex-mcp/internal/security"
+)
+
+const (
+	defaultReadLines = 200
+	maxReadLines     = 1000
+	maxReadKB        = 100
+	binarySniffBytes = 8000 // same window git uses to detect binary files
+)
+
+// ReadParams for ReadFile.
+type ReadParams struct {
+	Path       string // 绝对路径；指定 Codebase 时为相对该目录的路径
+	Codebase   string // 可选：目录名称或 ID
+	LineStart  int    // 从 1 开始，默认 1
+	LineEnd    int    // 含该行；默认 LineStart 起 200 行
+	IgnorePath string
+}
+
+// FileContent is a line range of a file returned by ReadFile.
+type FileContent struct {
+	Path       string `json:"path"`
+	LineStart  int    `json:"line_start"`
+	LineEnd    int    `json:"line_end"` // last line returned (0 when none)
+	TotalLines int    `json:"total_lines"`
+	Content    string `json:"content"`
+	Truncated  bool   `json:"truncated"` // the line or byte budget cut the requested range short
+}
+
+// ReadFile returns lines LineStart..LineEnd of a file inside an enabled directory. The file must not be
+// excluded by the ignore rules and must not be binary. At most maxReadLines lines and maxReadKB of content
+// are returned; TotalLines is always the real line count of the file.
+func ReadFile(p ReadParams) (*FileContent, error) {
+	if p.LineStart <= 0 {
+		p.LineStart = 1
+	}
+	if p.LineEnd <= 0 {
+		p.LineEnd = p.LineStart + defaultReadLines - 1
+	}
+	if p.LineEnd < p.LineStart {
+		return nil, &QueryError{Code: "invalid_range", Message: "line_end must not be before line_start"}
+	}
+	if p.Path == "" {
+		return nil, &QueryError{Code: "invalid_path", Message: "path is required"}
+	}
+	path, _, err := resolvePath(p.Path, p.Codebase, p.IgnorePath, false)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &QueryError{Code: "not_found", Message: "file not found", Query: p.Path}
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		return nil, &QueryError{Code: "not_a_file", Message: "path is not a regular file", Query: p.Path}
+	}
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	if head, _ := r.Peek(binarySniffBytes); isBinaryHead(head) {
+		return nil, &QueryError{Code: "binary_file", Message: "binary file, refusing to read", Query: p.Path}
+	}
+	end := p.LineEnd
+	if end-p.LineStart+1 > maxReadLines {
+		end = p.LineStart + maxReadLines - 1
+	}
+	budget := maxReadKB * 1024
+	var b bytes.Buffer
+	total, last := 0, 0
+	inLine, full := false, false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(chunk) > 0 {
+			if !inLine {
+				total++
+				inLine = true
+				if total > p.LineStart && total <= end && !full {
+					b.WriteByte('\n')
+				}
+			}
+			complete := chunk[len(chunk)-1] == '\n'
+			if total >= p.LineStart && total <= end && !full {
+				text := chunk
+				if complete {
+					text = bytes.TrimSuffix(bytes.TrimSuffix(text, []byte("\n")), []byte("\r"))
+				}
+				if room := budget - b.Len(); len(text) > room {
+					cut := max(room, 0)
+					for cut > 0 && !utf8.RuneStart(text[cut]) {
+						cut--
+					}
+					text, full = text[:cut], true
+				}
+				b.Write(text)
+				last = total
+			}
+			if complete {
+				inLine = false
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.LineStart > total && total > 0 {
+		return nil, &QueryError{Code: "invalid_range", Message: "line_start is past the end of the file (" + strconv.Itoa(total) + " lines)"}
+	}
+	return &FileContent{
+		Path:       path,
+		LineStart:  p.LineStart,
+		LineEnd:    last,
+		TotalLines: total,
+		Content:    b.String(),
+		Truncated:  full || last < min(p.LineEnd, total),
+	}, nil
+}
+
+// resolvePath turns a path (absolute, or relative to codebase) into an absolute path inside an enabled directory
+// and returns that directory too. Paths outside the enabled directories (also through symlinks) and paths
+// excluded by the ignore rules are rejected; wantDir requires an existing directory. The path returned has its
+// symlinks resolved (see resolveInDirectory): it is the one the ignore rules were checked on, and the one to open.
+func resolvePath(path, codebase, ignorePath string, wantDir bool) (string, db.Directory, error) {
+	abs, root, err := resolveInDirectory(path, codebase, wantDir)
+	if err != nil {
+		return "", db.Directory{}, err
+	}
+	// 与搜索相同的判定：全局规则、目录规则以及途经各级目录的 .gitignore / .ignore / .rgignore
+	if m, _ := decidePath(root, loadIgnoreRules(ignorePath), relSlash(filepath.Clean(root.Path), abs), wantDir); m != nil && !m.Negate {
+		return "", db.Directory{}, &QueryError{Code: "path_ignored", Message: "path is excluded by the ignore rules", Query: path}
+	}
+	return abs, root, nil
+}
+
+// resolveInDirectory is resolvePath without the ignore check: the path must exist and lie, symlinks resolved,
+// inside an enabled directory, the nearest of which is returned. The path returned is the resolved one, spelled
+// under the directory's path as registered, so an in-tree symlink gives its target.
+func resolveInDirectory(path, codebase string, wantDir bool) (string, db.Directory, error) {
+	dirs, err := db.ListEnabledDirectories()
+	if err != nil {
+		return "", db.Directory{}, err
+	}
+	var abs string
+	var roots []db.Directory
+	if codebase != "" {
+		d := findCodebase(dirs, codebase)
+		if d == nil {
+			return "", db.Directory{}, &QueryError{Code: "unknown_codebase", Message: "no enabled directory with this name or id", Query: codebase}
+		}
+		roots = []db.Directory{*d}
+		abs = filepath.Join(filepath.Clean(d.Path), filepath.FromSlash(path))
+		if filepath.IsAbs(path) {
+			abs = filepath.Clean(path)
+		}
+	} else {
+		if !filepath.IsAbs(path) {
+			return "", db.Directory{}, &QueryError{Code: "invalid_path", Message: "path must be absolute unless codebase is given", Query: path}
+		}
+		roots, abs = dirs, filepath.Clean(path)
+	}
+	denied := &QueryError{Code: "path_not_allowed", Message: "path is outside the enabled directories", Query: path}
+	if !security.IsPathAllowed(abs, cleanPaths(roots)) {
+		return "", db.Directory{}, denied
+	}
+	if wantDir {
+		if _, err := security.NormalizeAndValidateDir(abs); err != nil {
+			if errors.Is(err, os.ErrInvalid) {
+				return "", db.Directory{}, &QueryError{Code: "not_a_directory", Message: "path is not a directory", Query: path}
+			}
+			return "", db.Directory{}, &QueryError{Code: "not_found", Message: "directory not found", Query: path}
+		}
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", db.Directory{}, &QueryError{Code: "not_found", Message: "file not found", Query: path}
+	}
+	var root db.Directory
+	var rootReal string
+	allowed := false
+	for _, d := range roots {
+		r, err := filepath.EvalSymlinks(d.Path)
+		if err != nil || !security.IsPathAllowed(real, []string{r}) {
+			continue
+		}
+		// 目录可能嵌套，取最近的一个
+		if !allowed || len(d.Path) > len(root.Path) {
+			root, rootReal, allowed = d, r, true
+		}
+	}
+	if !allowed {
+		return "", db.Directory{}, denied
+	}
+	// 忽略判定与读取都用解析后的路径，目录内的符号链接不能绕过忽略规则
+	return filepath.Join(filepath.Clean(root.Path), filepath.FromSlash(relSlash(rootReal, real))), root, nil
+}
+
+// findCodebase returns the directory whose name, or else id, is ref.
+func findCodebase(dirs []db.Directory, ref string) *db.Directory {
+	for i := range dirs {
+		if dirs[i].Name == ref {
+			return &dirs[i]
+		}
+	}
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		for i := range dirs {
+			if dirs[i].ID == id {
+				return &dirs[i]
+			}
+		}
+	}
+	return nil
+}
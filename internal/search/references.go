@@ -0,0 +1,152 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/qiuxsgit/codex-mcp/internal/symbols"
+)
+
+const (
+	defaultReferenceLimit = 50
+	maxReferenceLimit     = 200
+	maxReferenceLineBytes = 200 // snippet is the referencing line, cut to this length
+)
+
+// ReferenceParams for FindReferences.
+type ReferenceParams struct {
+	Name       string // 符号名，区分大小写的完整标识符；Container.Name 时只看同时提到 Container 的文件
+	Container  string // 可选：所属类型 / 类，文件中必须出现该标识符
+	Language   string // 可选语言过滤
+	PathHint   string // 可选路径子串
+	Role       string // 可选范围：前端 / 后端
+	Limit      int
+	IgnorePath string
+	Workers    int // 并发解析的文件数，<=0 时取 GOMAXPROCS
+}
+
+// Reference is one line that mentions the symbol.
+type Reference struct {
+	Path        string `json:"path"`
+	LineStart   int    `json:"line_start"`
+	LineEnd     int    `json:"line_end"`
+	Snippet     string `json:"snippet"`
+	MatchReason string `json:"match_reason"` // definition / import / call / type_ref / reference / string / comment
+}
+
+// ReferenceGroup holds the references found in one registered directory.
+type ReferenceGroup struct {
+	Codebase   string      `json:"codebase"` // db.Directory name
+	References []Reference `json:"references"`
+}
+
+// ReferenceResult is the result of FindReferences. Truncated is set when the limit cut the list short.
+type ReferenceResult struct {
+	Groups    []ReferenceGroup `json:"groups"`
+	Total     int              `json:"total"`
+	Truncated bool             `json:"truncated,omitempty"`
+}
+
+// FindReferences returns the lines that mention a symbol across the enabled directories, grouped by directory,
+// in directory, file and line order. Each line is classified (symbols.References): call sites, imports, type
+// usages, the definition itself, and mentions in comments or strings. Without type information, a qualified
+// name (OrderService.cancel) only narrows the files to those that also mention the container.
+func FindReferences(p ReferenceParams) (*ReferenceResult, error) {
+	if p.Limit <= 0 {
+		p.Limit = defaultReferenceLimit
+	}
+	if p.Limit > maxReferenceLimit {
+		p.Limit = maxReferenceLimit
+	}
+	name, container := splitQualified(p.Name, p.Container)
+	if name == "" {
+		return nil, &QueryError{Code: "empty_query", Message: "name is required", Query: p.Name}
+	}
+	paths, err := newPathFilter(p.PathHint, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &ReferenceResult{Groups: []ReferenceGroup{}}
+	roots, err := selectRoots(p.Role, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return res, nil
+	}
+	allowedPaths := cleanPaths(roots)
+
+	sp := Params{Query: name, Case: CaseSensitive, Identifier: true, Language: p.Language, IgnorePath: p.IgnorePath, Workers: p.Workers, paths: paths}
+	var mentionsContainer *regexp.Regexp
+	if container != "" {
+		sp.Terms = []Term{{Text: container, Op: OpAnd}}
+		mentionsContainer = regexp.MustCompile(`(?:^|[^\w$])` + regexp.QuoteMeta(container) + `(?:[^\w$]|$)`)
+	}
+	q, err := compileQuery(sp)
+	if err != nil {
+		return nil, err
+	}
+	files, err := candidateFiles(sp, q, roots, allowedPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files are classified in batches, in order, so the scan stops soon after the limit is reached.
+	workers := p.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	budget := maxResponseKB * 1024
+	size := 0
+	var group *ReferenceGroup
+	groupDir := -1
+	for start := 0; start < len(files) && !res.Truncated; start += workers * 4 {
+		batch := files[start:min(start+workers*4, len(files))]
+		perFile := make([][]symbols.Reference, len(batch))
+		parallelFiles(len(batch), workers, func(i int) {
+			src, err := os.ReadFile(batch[i].path)
+			if err != nil || (mentionsContainer != nil && !mentionsContainer.Match(src)) {
+				return
+			}
+			perFile[i] = symbols.References(batch[i].path, src, name)
+		})
+		for i, refs := range perFile {
+			t := batch[i]
+			for _, r := range refs {
+				if res.Total >= p.Limit || size >= budget {
+					res.Truncated = true
+					break
+				}
+				if t.dirIdx != groupDir {
+					res.Groups = append(res.Groups, ReferenceGroup{Codebase: roots[t.dirIdx].Name})
+					group, groupDir = &res.Groups[len(res.Groups)-1], t.dirIdx
+				}
+				ref := Reference{Path: filepath.Clean(t.path), LineStart: r.Line, LineEnd: r.Line, Snippet: referenceSnippet(r.Text), MatchReason: r.Reason}
+				group.References = append(group.References, ref)
+				res.Total++
+				size += len(ref.Path) + len(ref.Snippet) + 64
+			}
+			if res.Truncated {
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// referenceSnippet trims the referencing line and cuts it to maxReferenceLineBytes.
+func referenceSnippet(line string) string {
+	line = strings.TrimSpace(line)
+	if len(line) <= maxReferenceLineBytes {
+		return line
+	}
+	cut := maxReferenceLineBytes
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + "..."
+}
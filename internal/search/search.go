@@ -3,23 +3,33 @@ package search
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"io/fs"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 
-	"github.com/qiuxsgit/codex-mcp/internal/config"
 	"github.com/qiuxsgit/codex-mcp/internal/db"
 	"github.com/qiuxsgit/codex-mcp/internal/security"
 )
 
 const (
-	maxSnippetLines = 15
-	maxResponseKB   = 50
+	defaultContextLines = 7  // context lines before / after a hit when not given
+	maxContextLines     = 50 // upper bound of context_before / context_after
+	maxMergedLines      = 60 // hits are merged into one snippet while it stays within this many lines
+	maxLineSubmatches   = 10 // submatches reported per line (minified files can have thousands)
+	maxResponseKB       = 50
+	// sort=relevance ranks a window of matches taken in path order: rankPoolFactor times the page limit, at
+	// most rankPoolSize matches / rankPoolKB of output. The window covers the whole candidate set for all but
+	// common queries, so a definition is not outranked by hits that merely come first in path order (fixtures,
+	// vendored copies), while the scan still stops early instead of collecting every match.
+	rankPoolFactor = 50
+	rankPoolSize   = 5000
+	rankPoolKB     = 8 * 1024
 )
 
 var rgWarnOnce sync.Once
@@ -32,45 +42,161 @@ func RgAvailable() bool {
 
 // Match is one search result.
 type Match struct {
-	Path        string `json:"path"`
-	LineStart   int    `json:"line_start"`
-	LineEnd     int    `json:"line_end"`
-	Snippet     string `json:"snippet"`
-	MatchReason string `json:"match_reason"`
+	Path        string     `json:"path"`
+	LineStart   int        `json:"line_start"`
+	LineEnd     int        `json:"line_end"`
+	Snippet     string     `json:"snippet"`
+	MatchReason string     `json:"match_reason"`
+	MatchLines  []int      `json:"match_lines"` // lines of the snippet that matched
+	Columns                // first hit of the snippet, on line MatchLines[0]
+	Submatches  []Submatch `json:"submatches"`         // every hit of the snippet, at most maxLineSubmatches per line
+	Minified    bool       `json:"minified,omitempty"` // long lines of the snippet were clipped (…), e.g. minified code
+	Binary      bool       `json:"binary,omitempty"`   // the file turns binary (a NUL byte) after this match; the search of it stopped there
+	Score       float64    `json:"score"`              // relevance score, higher is better (see rank.go)
+
+	dirIdx int      // index of the root in the searched directories, for cursors
+	line   int      // last hit merged into this match
+	texts  []string // content of the hit lines
+}
+
+// Columns locate a hit within its line: 0-based offsets, end exclusive, in bytes (UTF-8) and in UTF-16 code
+// units (editors, JS clients). Both engines compute them with the same matcher, so they agree.
+type Columns struct {
+	ColumnStart      int `json:"column_start"`
+	ColumnEnd        int `json:"column_end"`
+	ColumnStartUTF16 int `json:"column_start_utf16"`
+	ColumnEndUTF16   int `json:"column_end_utf16"`
+}
+
+// Submatch is one hit inside a snippet.
+type Submatch struct {
+	Line int `json:"line"`
+	Columns
+}
+
+// Result is one page of search results. NextCursor is set when more matches may follow;
+// pass it back as Params.Cursor to get the next page.
+type Result struct {
+	Matches    []Match `json:"matches"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
 
 // Params for search.
 type Params struct {
-	Query      string // 搜索关键词
-	Language   string // 可选语言过滤
-	PathHint   string // 可选路径子串
-	Role       string // 可选范围：前端 / 后端，只搜对应角色的目录
-	Limit      int
-	IgnorePath string
+	Query            string   // 搜索关键词
+	Mode             string   // literal（默认）或 regex
+	Case             string   // sensitive / insensitive / smart（默认）
+	WholeWord        bool     // 整词匹配（rg -w）
+	Identifier       bool     // 标识符边界：在整词基础上把 _ 与 $ 视为单词字符
+	Terms            []Term   // 可选：文件级布尔多词查询（and / or / not），Query 视为一个 and 词
+	Language         string   // 可选语言过滤
+	PathHint         string   // 可选：文件相对目录根的路径须包含该子串
+	IncludeGlobs     []string // 可选：只搜匹配的文件（rg -g 语义）
+	ExcludeGlobs     []string // 可选：排除匹配的文件或目录
+	Role             string   // 可选范围：前端 / 后端，只搜对应角色的目录
+	Codebase         string   // 可选：只搜该目录（名称或 ID）
+	Limit            int
+	IgnorePath       string
+	Workers          int    // 内置引擎并发扫描的文件数，<=0 时取 GOMAXPROCS
+	Cursor           string // 可选：上一页返回的 next_cursor，继续翻页
+	Sort             string // relevance（默认）/ path
+	ContextBefore    *int   // 可选：匹配行之前的上下文行数，默认 7
+	ContextAfter     *int   // 可选：匹配行之后的上下文行数，默认 7
+	IncludeGenerated bool   // 搜索生成的文件（Code generated / @generated 头、锁文件），默认跳过
+
+	maxBytes int         // output budget of one engine run, set by Search
+	paths    *pathFilter // compiled PathHint / globs, set by the entry points
 }
 
 // Search runs search in enabled directories. If ripgrep (rg) is installed, uses rg for better performance; otherwise falls back to built-in pure Go search and logs a one-time hint to install rg.
-func Search(p Params) ([]Match, error) {
+// Matches are ordered by directory (id), file (walk order) and line, so pages resumed from a cursor line up.
+func Search(p Params) (*Result, error) {
 	if p.Limit <= 0 {
 		p.Limit = 10
 	}
 	if p.Limit > 20 {
 		p.Limit = 20
 	}
+	p.Mode = normalizeOption(p.Mode)
+	p.Case = normalizeOption(p.Case)
+	p.Sort = normalizeOption(p.Sort)
+	switch p.Sort {
+	case "":
+		p.Sort = SortRelevance
+	case SortRelevance, SortPath:
+	default:
+		return nil, &QueryError{Code: "invalid_sort", Message: "sort must be relevance or path"}
+	}
+	q, err := compileQuery(p)
+	if err != nil {
+		return nil, err
+	}
+	if p.paths, err = newPathFilter(p.PathHint, p.IncludeGlobs, p.ExcludeGlobs); err != nil {
+		return nil, err
+	}
+
+	roots, err := selectRoots(p.Role, p.Codebase)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return &Result{Matches: []Match{}}, nil
+	}
+	allowedPaths := cleanPaths(roots)
 
+	var from *resume
+	if p.Cursor != "" {
+		if from, err = decodeCursor(p.Cursor, p, roots); err != nil {
+			return nil, err
+		}
+	}
+	if p.Sort == SortRelevance {
+		return searchRanked(p, q, roots, allowedPaths, from)
+	}
+
+	var after *position
+	if from != nil {
+		after = from.last
+	}
+	p.maxBytes = maxResponseKB * 1024
+	matches, err := searchRoots(p, q, roots, allowedPaths, after)
+	if err != nil {
+		return nil, err
+	}
+	scoreMatches(q, roots, matches)
+	res := &Result{Matches: matches}
+	if matches == nil {
+		res.Matches = []Match{}
+	}
+	if len(matches) > 0 && (len(matches) >= p.Limit || outputBytes(matches) >= p.maxBytes) {
+		res.NextCursor = nextCursor(p, roots, matches[len(matches)-1], nil, 0, 0)
+	}
+	return res, nil
+}
+
+// selectRoots returns the enabled directories to search, filtered by codebase (name or id) and role (前端 / 后端).
+// An unknown codebase is a QueryError.
+func selectRoots(role, codebase string) ([]db.Directory, error) {
 	dirs, err := db.ListEnabledDirectories()
 	if err != nil {
 		return nil, err
 	}
+	if codebase != "" {
+		d := findCodebase(dirs, codebase)
+		if d == nil {
+			return nil, &QueryError{Code: "unknown_codebase", Message: "no enabled directory with this name or id; call list_codebases", Query: codebase}
+		}
+		dirs = []db.Directory{*d}
+	}
 	if len(dirs) == 0 {
-		return []Match{}, nil
+		return nil, nil
 	}
 
 	// 按角色过滤：前端 -> 前端业务/前端框架，后端 -> 后端业务/后端框架
-	if p.Role != "" {
+	if role != "" {
 		var filtered []db.Directory
 		for _, d := range dirs {
-			switch p.Role {
+			switch role {
 			case "前端":
 				if d.Role == "前端业务" || d.Role == "前端框架" {
 					filtered = append(filtered, d)
@@ -85,56 +211,167 @@ func Search(p Params) ([]Match, error) {
 		}
 		dirs = filtered
 	}
-	if len(dirs) == 0 {
-		return []Match{}, nil
+	return dirs, nil
+}
+
+// cleanPaths returns the cleaned root paths, as passed to security.IsPathAllowed.
+func cleanPaths(roots []db.Directory) []string {
+	allowedPaths := make([]string, len(roots))
+	for i := range roots {
+		allowedPaths[i] = filepath.Clean(roots[i].Path)
 	}
+	return allowedPaths
+}
 
-	var searchDirs []string
-	for _, d := range dirs {
-		if p.PathHint != "" && !strings.Contains(d.Path, p.PathHint) {
-			continue
+// searchRanked serves sort=relevance: it collects a window of up to rankPoolSize matches in path order,
+// ranks them, and pages through the ranked window; the next window starts after the last match of this one.
+func searchRanked(p Params, q *query, roots []db.Directory, allowedPaths []string, from *resume) (*Result, error) {
+	var start *position
+	offset, size := 0, rankPool(p.Limit)
+	if from != nil {
+		start, offset = from.start, from.offset
+		if from.pool > 0 {
+			size = from.pool // the window of the first page, whatever the limit of this one
 		}
-		searchDirs = append(searchDirs, d.Path)
 	}
-	if len(searchDirs) == 0 {
-		return []Match{}, nil
+	pp := p
+	pp.Limit = size
+	pp.maxBytes = rankPoolKB * 1024 / rankPoolSize * size
+	pool, err := searchRoots(pp, q, roots, allowedPaths, start)
+	if err != nil {
+		return nil, err
 	}
+	windowEnd := len(pool) - 1 // last match of the window in path order
+	full := len(pool) >= pp.Limit || outputBytes(pool) >= pp.maxBytes
+	scoreMatches(q, roots, pool)
+	ranked := make([]Match, len(pool))
+	copy(ranked, pool)
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
 
-	allowedPaths := make([]string, len(searchDirs))
-	for i := range searchDirs {
-		allowedPaths[i] = filepath.Clean(searchDirs[i])
+	// Re-ranking must reproduce what earlier pages saw: the match before offset is the last one returned.
+	if offset > 0 && (offset > len(ranked) || !samePosition(ranked[offset-1], from.last, roots)) {
+		return nil, staleCursor("search results changed since the cursor was issued; start again without cursor")
+	}
+	res := &Result{Matches: []Match{}}
+	budget := maxResponseKB * 1024
+	for _, m := range ranked[offset:] {
+		if len(res.Matches) >= p.Limit || outputBytes(res.Matches) >= budget {
+			break
+		}
+		res.Matches = append(res.Matches, m)
 	}
+	if len(res.Matches) == 0 {
+		return res, nil
+	}
+	last := res.Matches[len(res.Matches)-1]
+	consumed := offset + len(res.Matches)
+	switch {
+	case consumed < len(ranked):
+		res.NextCursor = nextCursor(p, roots, last, start, consumed, size)
+	case full:
+		// window exhausted: the next one starts after this window's last match in path order
+		res.NextCursor = nextCursor(p, roots, last, matchPosition(pool[windowEnd], roots), 0, size)
+	}
+	return res, nil
+}
 
-	if RgAvailable() {
-		return searchWithRg(p, searchDirs, allowedPaths)
+// rankPool returns the size of the relevance window for a page of limit matches.
+func rankPool(limit int) int {
+	return min(max(limit, 1)*rankPoolFactor, rankPoolSize)
+}
+
+// searchRoots picks the engine for q and returns matches after the cursor position (nil = from the start).
+func searchRoots(p Params, q *query, roots []db.Directory, allowedPaths []string, after *position) ([]Match, error) {
+	useRg := RgAvailable()
+	if !useRg {
+		rgWarnOnce.Do(func() {
+			log.Printf("[search] ripgrep (rg) 未安装，使用内置搜索。建议安装 rg 以提升搜索性能: https://github.com/BurntSushi/ripgrep#installation")
+		})
 	}
-	rgWarnOnce.Do(func() {
-		log.Printf("[search] ripgrep (rg) 未安装，使用内置搜索。建议安装 rg 以提升搜索性能: https://github.com/BurntSushi/ripgrep#installation")
-	})
-	return searchBuiltin(p, searchDirs, allowedPaths)
+	return searchEngine(useRg, p, q, roots, allowedPaths, after)
 }
 
-// searchWithRg runs ripgrep in searchDirs and parses output into matches.
-func searchWithRg(p Params, searchDirs, allowedPaths []string) ([]Match, error) {
+// searchEngine runs q with rg when useRg is set and rg can prefilter q, otherwise with the built-in engine.
+func searchEngine(useRg bool, p Params, q *query, roots []db.Directory, allowedPaths []string, after *position) ([]Match, error) {
+	if useRg {
+		if m := q.single(); m != nil {
+			if m.rgArgs != nil {
+				return searchWithRg(p, m, roots, allowedPaths, after)
+			}
+		} else {
+			// 布尔查询：rg -l 取候选文件，再逐个文件做 and / or / not 判定
+			files, ok, err := rgCandidateFiles(p, q, roots, after)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return searchCandidates(q, files, p, allowedPaths), nil
+			}
+		}
+		// 正则中提取不出必需的字面量，rg 无法做等价预过滤，改用内置引擎保证结果一致
+	}
+	return searchBuiltin(p, q, roots, allowedPaths, after)
+}
+
+// outputBytes approximates the response size of matches, as counted against maxResponseKB.
+func outputBytes(matches []Match) int {
+	n := 0
+	for _, m := range matches {
+		n += len(m.Path) + len(m.Snippet) + 64
+	}
+	return n
+}
+
+// scanTarget is one file handed to the scanner pool.
+type scanTarget struct {
+	path      string
+	dirIdx    int
+	afterLine int // only hits after this line (cursor file); 0 = all
+}
+
+// skipBefore applies the cursor to a file: skip reports the file was fully returned by earlier pages,
+// afterLine is the line to resume after within the cursor file.
+func (c *position) skipBefore(dirIdx int, rel string) (skip bool, afterLine int) {
+	if c == nil || dirIdx > c.dirIdx {
+		return false, 0
+	}
+	if dirIdx < c.dirIdx {
+		return true, 0
+	}
+	if rel == c.rel {
+		return false, c.line
+	}
+	return walkLess(rel, c.rel), 0
+}
+
+// rgBaseArgs returns the rg arguments shared by every rg invocation in directory d: fixed ignore dirs, ignore
+// files, language and include / exclude globs. The path hint is applied to rg's output (pathFilter.keep).
+func rgBaseArgs(p Params, d db.Directory) []string {
 	args := []string{
-		"-n",
-		"--no-heading",
+		"--hidden",           // 与内置引擎一致：不跳过隐藏文件（.git 等由下面的固定规则排除）
+		"--no-ignore-global", // 内置引擎不读取全局 gitignore（core.excludesFile），保持两者一致
 		"-g", "!.git",
 		"-g", "!node_modules",
-		"-g", "!target",
-		"-g", "!vendor",
 	}
-	if p.IgnorePath != "" {
-		_, _ = config.ReadIgnoreFile(p.IgnorePath)
+	if !d.UseVCSIgnore {
+		args = append(args, "--no-ignore-vcs")
+	}
+	if p.IgnorePath != "" && GlobalIgnore(p.IgnorePath).Exists() {
 		args = append(args, "--ignore-file", p.IgnorePath)
 	}
-	if p.Language != "" {
-		args = append(args, "-t", strings.ToLower(p.Language))
+	// 目录自身的规则在全局忽略文件之后传入，优先级更高
+	if f := rgDirectoryIgnoreFile(d); f != "" {
+		args = append(args, "--ignore-file", f)
 	}
-	args = append(args, regexp.QuoteMeta(p.Query))
-	args = append(args, searchDirs...)
+	args = append(args, rgLanguageArgs(p.Language)...)
+	return append(args, p.paths.rgArgs()...)
+}
 
+// runRg runs rg with args in dir and returns stdout. Exit code 1 (no match) is not an error.
+// Running in the searched root makes rg match globs containing '/' relative to it.
+func runRg(dir string, args []string) (*bytes.Buffer, error) {
 	cmd := exec.Command("rg", args...)
+	cmd.Dir = dir
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -145,233 +382,467 @@ func searchWithRg(p Params, searchDirs, allowedPaths []string) ([]Match, error)
 		}
 		// rg exits 1 when no match; ignore
 	}
+	return &stdout, nil
+}
 
-	linePattern := regexp.MustCompile(`^(.+?):(\d+):(.*)`)
-	var matches []Match
-	scanner := bufio.NewScanner(&stdout)
-	totalBytes := 0
-	maxBytes := maxResponseKB * 1024
-
-	for scanner.Scan() && len(matches) < p.Limit && totalBytes < maxBytes {
-		line := scanner.Text()
-		sub := linePattern.FindStringSubmatch(line)
-		if sub == nil {
-			continue
+// rgCandidateFiles lists files that may satisfy a boolean query, using rg -l on one positive term:
+// the first "and" term, or else the union over all "or" terms. ok is false when a needed term has no rg prefilter.
+// Files come back in search order (root, then walk order); the boolean evaluation itself happens in a
+// second pass (searchCandidates).
+func rgCandidateFiles(p Params, q *query, roots []db.Directory, after *position) (files []scanTarget, ok bool, err error) {
+	var terms []*matcher
+	for _, m := range q.and {
+		if m.rgArgs != nil {
+			terms = []*matcher{m}
+			break
 		}
-		path, lineStr, content := sub[1], sub[2], sub[3]
-		path = filepath.Clean(path)
-		if !security.IsPathAllowed(path, allowedPaths) {
-			continue
+	}
+	if terms == nil {
+		if len(q.or) == 0 {
+			return nil, false, nil
 		}
-		lineNum, err := strconv.Atoi(lineStr)
-		if err != nil {
-			continue
+		for _, m := range q.or {
+			if m.rgArgs == nil {
+				return nil, false, nil
+			}
 		}
-		snippet := buildSnippet(path, lineNum, content, maxSnippetLines)
-		if snippet == "" {
+		terms = q.or
+	}
+	for dirIdx, d := range roots {
+		if after != nil && dirIdx < after.dirIdx {
 			continue
 		}
-		lines := strings.Split(snippet, "\n")
-		start, end := lineNum, lineNum
-		if len(lines) > 1 {
-			half := (len(lines) - 1) / 2
-			start = lineNum - half
-			end = lineNum + (len(lines) - 1 - half)
-			if start < 1 {
-				start = 1
+		root := filepath.Clean(d.Path)
+		seen := make(map[string]bool)
+		var rels []string
+		for _, m := range terms {
+			args := append([]string{"-l"}, rgBaseArgs(p, d)...)
+			args = append(args, m.rgArgs...)
+			args = append(args, "--", root)
+			stdout, err := runRg(root, args)
+			if err != nil {
+				return nil, false, err
+			}
+			sc := bufio.NewScanner(stdout)
+			for sc.Scan() {
+				rel := relSlash(root, filepath.Clean(sc.Text()))
+				if rel != "" && !seen[rel] && p.paths.keep(rel) {
+					seen[rel] = true
+					rels = append(rels, rel)
+				}
 			}
 		}
-		m := Match{
-			Path:        path,
-			LineStart:   start,
-			LineEnd:     end,
-			Snippet:     snippet,
-			MatchReason: "content",
+		sort.Slice(rels, func(i, j int) bool { return walkLess(rels[i], rels[j]) })
+		for _, rel := range rels {
+			skip, afterLine := after.skipBefore(dirIdx, rel)
+			if skip {
+				continue
+			}
+			files = append(files, scanTarget{path: filepath.Join(root, filepath.FromSlash(rel)), dirIdx: dirIdx, afterLine: afterLine})
 		}
-		matches = append(matches, m)
-		totalBytes += len(path) + len(snippet) + 64
 	}
-	return matches, nil
+	return files, true, nil
 }
 
-// searchBuiltin runs pure Go (WalkDir + regex) search.
-func searchBuiltin(p Params, searchDirs, allowedPaths []string) ([]Match, error) {
-	var rules *IgnoreRules
-	if p.IgnorePath != "" {
-		data, _ := config.ReadIgnoreFile(p.IgnorePath)
-		if len(data) > 0 {
-			rules = ParseIgnoreRules(data)
+// searchCandidates evaluates q against each candidate file (second pass after rg -l).
+func searchCandidates(q *query, files []scanTarget, p Params, allowedPaths []string) []Match {
+	return scanFiles(q, p, func(emit func(scanTarget) bool) {
+		for _, t := range files {
+			if security.IsPathAllowed(t.path, allowedPaths) && !emit(t) {
+				return
+			}
 		}
-	}
-	if rules == nil {
-		rules = ParseIgnoreRules(nil)
-	}
+	})
+}
 
-	pattern := regexp.QuoteMeta(p.Query)
-	re, err := regexp.Compile("(?i)" + pattern)
-	if err != nil {
-		return nil, err
+// rgText is a path or line in rg --json output: text when it is valid UTF-8, base64 bytes otherwise.
+type rgText struct {
+	Text  *string `json:"text"`
+	Bytes []byte  `json:"bytes"`
+}
+
+func (t rgText) String() string {
+	if t.Text != nil {
+		return *t.Text
 	}
+	return string(t.Bytes)
+}
+
+// rgEvent is one line of rg --json output; only "match" events are used.
+type rgEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		Path       rgText `json:"path"`
+		Lines      rgText `json:"lines"`
+		LineNumber int    `json:"line_number"`
+	} `json:"data"`
+}
 
-	extFilter := languageToExt(p.Language)
-	maxBytes := maxResponseKB * 1024
+// searchWithRg runs ripgrep once per root (rg --json --sort path, so output follows walk order) and parses output
+// into matches. rg only prefilters lines; each reported line is verified with m, which also gives the hit
+// columns (rg's own submatches are not used), so results match searchBuiltin. rg skips binary files itself;
+// generated files are recognised when their snippets are read.
+func searchWithRg(p Params, m *matcher, roots []db.Directory, allowedPaths []string, after *position) ([]Match, error) {
 	var matches []Match
-	var totalBytes int
+	totalBytes := 0
+	maxBytes := p.maxBytes
+	before, afterLines := p.contextLines()
 
-	for _, root := range searchDirs {
+	// hits of the current file are grouped; when rg moves on to the next file, its snippets are cut in one read
+	var cur scanTarget
+	var g *hitGrouper
+	var skipPath string // generated file being skipped
+	// flush adds the matches of the current file. The read that cuts the snippets also checks the file's head
+	// for a generated-file marker and stops at binary data; it reports false when the file was dropped.
+	flush := func() bool {
+		if g == nil {
+			return true
+		}
+		groups, binary := readSnippets(cur.path, g.groups, !p.IncludeGenerated)
+		g = nil
+		if len(groups) == 0 {
+			skipPath = cur.path
+			return false
+		}
+		fileMatches := groupMatches(cur, groups, maxBytes-totalBytes)
+		if binary {
+			markBinary(fileMatches)
+		}
+		for _, mt := range fileMatches {
+			if len(matches) >= p.Limit || totalBytes >= maxBytes {
+				break
+			}
+			matches = append(matches, mt)
+			totalBytes += len(mt.Path) + len(mt.Snippet) + 64
+		}
+		return true
+	}
+
+	for dirIdx, d := range roots {
 		if len(matches) >= p.Limit || totalBytes >= maxBytes {
 			break
 		}
+		if after != nil && dirIdx < after.dirIdx {
+			continue
+		}
+		root := filepath.Clean(d.Path)
+		args := append([]string{"--json", "--sort", "path"}, rgBaseArgs(p, d)...)
+		args = append(args, m.rgArgs...)
+		args = append(args, "--", root)
+		stdout, err := runRg(root, args)
+		if err != nil {
+			return nil, err
+		}
+
+		dec := json.NewDecoder(stdout)
+		for {
+			var ev rgEvent
+			if err := dec.Decode(&ev); err != nil {
+				break // io.EOF, or output cut short
+			}
+			if ev.Type != "match" {
+				continue
+			}
+			lineNum := ev.Data.LineNumber
+			content := strings.TrimSuffix(strings.TrimSuffix(ev.Data.Lines.String(), "\n"), "\r")
+			locs := m.FindAll(content)
+			if len(locs) == 0 {
+				continue
+			}
+			path := filepath.Clean(ev.Data.Path.String())
+			if !security.IsPathAllowed(path, allowedPaths) {
+				continue
+			}
+			rel := relSlash(root, path)
+			if !p.paths.keep(rel) {
+				continue
+			}
+			if skip, afterLine := after.skipBefore(dirIdx, rel); skip || lineNum <= afterLine {
+				continue
+			}
+			if path == skipPath {
+				continue
+			}
+			if g == nil || cur.path != path {
+				flush()
+				if len(matches) >= p.Limit || totalBytes >= maxBytes {
+					break
+				}
+				if !p.IncludeGenerated && isLockFile(path) {
+					skipPath = path
+					continue
+				}
+				cur, g = scanTarget{path: path, dirIdx: dirIdx}, newHitGrouper(before, afterLines, false)
+			}
+			h := lineHit{lineNum, content, locs}
+			if !g.joins(h) && len(matches)+len(g.groups) >= p.Limit {
+				if flush() {
+					break
+				}
+				continue // the file was dropped (generated): its remaining hits are skipped
+			}
+			g.add(h)
+		}
+		flush()
+	}
+	return matches, nil
+}
+
+// searchBuiltin runs pure Go (WalkDir + regex) search: a single walker feeds a pool of file scanners
+// (see scanFiles). When a trigram index exists for a root, files the index rules out are never opened.
+func searchBuiltin(p Params, q *query, roots []db.Directory, allowedPaths []string, after *position) ([]Match, error) {
+	matches := scanFiles(q, p, func(emit func(scanTarget) bool) {
+		walkTargets(p, q, roots, allowedPaths, after, emit)
+	})
+	return matches, nil
+}
+
+// walkTargets walks roots in order and emits the files that may match q: ignore rules (the global file and
+// the ignore files of each directory, see dirIgnores), the language filter,
+// the path filter, the cursor and the trigram index are applied. q may be nil to list every file. It stops when emit returns false.
+func walkTargets(p Params, q *query, roots []db.Directory, allowedPaths []string, after *position, emit func(scanTarget) bool) {
+	rules := loadIgnoreRules(p.IgnorePath)
+	exts := languageExtensions(p.Language)
+	for dirIdx, dir := range roots {
+		if after != nil && dirIdx < after.dirIdx {
+			continue
+		}
+		root := filepath.Clean(dir.Path)
+		ignores := newDirIgnores(dir, rules)
+		var mayMatch func(rel string, info fs.FileInfo) bool
+		if q != nil {
+			mayMatch = candidateFilter(q, dir)
+		}
+		stopped := false
 		_ = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 			if err != nil {
 				return nil
 			}
-			if len(matches) >= p.Limit || totalBytes >= maxBytes {
-				return filepath.SkipAll
-			}
 			path = filepath.Clean(path)
 			if !security.IsPathAllowed(path, allowedPaths) {
 				return filepath.SkipDir
 			}
+			rel := relSlash(root, path)
 			if d.IsDir() {
-				if rules.ShouldIgnore(path, true) {
+				if ignores.excluded(rel, true) || p.paths.skipDir(rel) {
+					return filepath.SkipDir
+				}
+				// 游标之前的整个目录已在前几页返回过
+				if after != nil && dirIdx == after.dirIdx && rel != "." && walkLess(rel, after.rel) && !strings.HasPrefix(after.rel, rel+"/") {
 					return filepath.SkipDir
 				}
+				ignores.enter(rel, path)
 				return nil
 			}
-			if rules.ShouldIgnore(path, false) {
+			if ignores.excluded(rel, false) || !p.paths.keep(rel) {
 				return nil
 			}
-			if extFilter != "" && !strings.HasSuffix(strings.ToLower(path), extFilter) {
+			skip, afterLine := after.skipBefore(dirIdx, rel)
+			if skip {
 				return nil
 			}
-			fileMatches := searchFile(path, re, p.Limit-len(matches), maxBytes-totalBytes)
-			for _, m := range fileMatches {
-				matches = append(matches, m)
-				totalBytes += len(m.Path) + len(m.Snippet) + 64
+			if exts != nil && !hasLanguageExt(path, exts) {
+				return nil
+			}
+			if mayMatch != nil {
+				info, err := d.Info()
+				if err == nil && !mayMatch(rel, info) {
+					return nil
+				}
+			}
+			if !emit(scanTarget{path: path, dirIdx: dirIdx, afterLine: afterLine}) {
+				stopped = true
+				return filepath.SkipAll
 			}
 			return nil
 		})
+		if stopped {
+			return
+		}
 	}
-	return matches, nil
 }
 
-func languageToExt(lang string) string {
-	switch strings.ToLower(lang) {
-	case "go":
-		return ".go"
-	case "rust", "rs":
-		return ".rs"
-	case "python", "py":
-		return ".py"
-	case "javascript", "js":
-		return ".js"
-	case "typescript", "ts":
-		return ".ts"
-	case "java":
-		return ".java"
-	case "c":
-		return ".c"
-	case "cpp", "c++":
-		return ".cpp"
-	case "ruby", "rb":
-		return ".rb"
-	case "php":
-		return ".php"
-	case "swift":
-		return ".swift"
-	case "kotlin", "kt":
-		return ".kt"
-	case "scala":
-		return ".scala"
-	case "sh", "shell", "bash":
-		return ".sh"
-	case "html":
-		return ".html"
-	case "css":
-		return ".css"
-	case "json":
-		return ".json"
-	case "yaml", "yml":
-		return ".yml"
-	default:
-		return ""
+// loadIgnoreRules returns the shared rules of the global ignore file (see IgnoreFile); no file configured
+// gives the fixed rules only.
+func loadIgnoreRules(ignorePath string) *IgnoreRules {
+	if ignorePath == "" {
+		return ParseIgnoreRules(nil, "")
+	}
+	return GlobalIgnore(ignorePath).Rules()
+}
+
+// languageExts maps a language (language parameter, lower case) to the file extensions it selects. It is the
+// single source for both engines: the built-in walker matches file names against it, and rg gets a file type
+// built from the same list (rgLanguageArgs) instead of its own -t definitions, which differ.
+var languageExts = map[string][]string{
+	"go":         {".go"},
+	"rust":       {".rs"},
+	"python":     {".py", ".pyi"},
+	"javascript": {".js", ".jsx", ".mjs", ".cjs"},
+	"typescript": {".ts", ".tsx", ".mts", ".cts"},
+	"java":       {".java"},
+	"c":          {".c", ".h"},
+	"cpp":        {".cpp", ".cc", ".cxx", ".hpp", ".hh", ".hxx", ".h"},
+	"csharp":     {".cs"},
+	"ruby":       {".rb"},
+	"php":        {".php"},
+	"swift":      {".swift"},
+	"kotlin":     {".kt", ".kts"},
+	"scala":      {".scala"},
+	"sh":         {".sh", ".bash"},
+	"html":       {".html", ".htm"},
+	"css":        {".css"},
+	"json":       {".json"},
+	"yaml":       {".yaml", ".yml"},
+	"vue":        {".vue"},
+}
+
+// languageAliases are other accepted spellings of the languageExts keys.
+var languageAliases = map[string]string{
+	"rs": "rust", "py": "python", "js": "javascript", "ts": "typescript", "c++": "cpp", "rb": "ruby",
+	"kt": "kotlin", "cs": "csharp", "shell": "sh", "bash": "sh", "yml": "yaml",
+}
+
+// languageExtensions returns the extensions selected by lang; nil (no filter) for "" or an unknown language.
+func languageExtensions(lang string) []string {
+	lang = strings.ToLower(lang)
+	if a, ok := languageAliases[lang]; ok {
+		lang = a
+	}
+	return languageExts[lang]
+}
+
+// hasLanguageExt reports whether the file name of path ends with one of exts. Like rg's type globs, the
+// comparison is case-sensitive.
+func hasLanguageExt(path string, exts []string) bool {
+	for _, ext := range exts {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
 	}
+	return false
 }
 
-func searchFile(filePath string, re *regexp.Regexp, maxMatches int, maxBytes int) []Match {
-	f, err := os.Open(filePath)
+// rgLanguageArgs defines an rg file type from languageExts and selects it.
+func rgLanguageArgs(lang string) []string {
+	exts := languageExtensions(lang)
+	if len(exts) == 0 {
+		return nil
+	}
+	args := make([]string, 0, 2*len(exts)+2)
+	for _, ext := range exts {
+		args = append(args, "--type-add", "codexlang:*"+ext)
+	}
+	return append(args, "-t", "codexlang")
+}
+
+// searchFile scans one file for q, reading it once: snippets are cut from the lines as they go by (hitGrouper).
+// For a single-term query it stops once p.Limit snippets are complete; a boolean query needs the whole file,
+// since a later line may satisfy an "and" term or hit a "not" term. Snippets come from the lines that matched
+// a positive term. Hits on lines <= t.afterLine are not returned. Binary files (a NUL byte in the head) and,
+// unless p.IncludeGenerated, generated files are skipped; a NUL byte further on ends the scan, and the hits
+// before it are returned flagged Binary, as rg does.
+func searchFile(t scanTarget, q *query, p Params) []Match {
+	if !p.IncludeGenerated && isLockFile(t.path) {
+		return nil
+	}
+	f, err := os.Open(t.path)
 	if err != nil {
 		return nil
 	}
 	defer f.Close()
+	lr := newLineReader(f)
+	// 与 rg 一致：含 NUL 字节的文件视为二进制文件，跳过
+	head := lr.head(binarySniffBytes)
+	if isBinaryHead(head) || !p.IncludeGenerated && isGeneratedHead(head) {
+		return nil
+	}
 
-	var matches []Match
-	sc := bufio.NewScanner(f)
+	before, after := p.contextLines()
+	g := newHitGrouper(before, after, true)
+	single := q.single()
+	state := q.newFileState()
 	lineNum := 0
-	fileBytes := 0
+	stopped := false // single term: the page is full, only the open snippets still take lines
+	binary := false
 
-	for sc.Scan() && len(matches) < maxMatches && fileBytes < maxBytes {
+	for {
+		line, ok := lr.next()
+		if !ok {
+			break
+		}
 		lineNum++
-		line := sc.Text()
-		if !re.MatchString(line) {
-			continue
+		if strings.IndexByte(line, 0) >= 0 {
+			// 与 rg 一致：遇到二进制内容即停止扫描，保留此前的命中
+			binary = true
+			break
 		}
-		snippet := buildSnippet(filePath, lineNum, line, maxSnippetLines)
-		if snippet == "" {
+		g.line(lineNum, line)
+		if single != nil {
+			if stopped {
+				if g.complete() {
+					break
+				}
+				continue
+			}
+			if lineNum <= t.afterLine {
+				continue
+			}
+			locs := single.FindAll(line)
+			if len(locs) == 0 {
+				if len(g.groups) >= p.Limit && g.complete() && !g.mayJoin(lineNum+1) {
+					break
+				}
+				continue
+			}
+			h := lineHit{lineNum, line, locs}
+			if !g.joins(h) && len(g.groups) >= p.Limit {
+				stopped = true
+				if g.complete() {
+					break
+				}
+				continue
+			}
+			g.add(h)
 			continue
 		}
-		lines := strings.Split(snippet, "\n")
-		start, end := lineNum, lineNum
-		if len(lines) > 1 {
-			half := (len(lines) - 1) / 2
-			start = lineNum - half
-			end = lineNum + (len(lines) - 1 - half)
-			if start < 1 {
-				start = 1
+		if locs := state.scanLine(line); locs != nil && lineNum > t.afterLine {
+			if h := (lineHit{lineNum, line, locs}); g.joins(h) || len(g.groups) < p.Limit {
+				g.add(h)
 			}
 		}
-		m := Match{
-			Path:        filePath,
-			LineStart:   start,
-			LineEnd:     end,
-			Snippet:     snippet,
-			MatchReason: "content",
+		if state.negated {
+			return nil
 		}
-		matches = append(matches, m)
-		fileBytes += len(filePath) + len(snippet) + 64
 	}
-
+	if err := lr.Err(); err != nil {
+		// 读到一半出错：保留已找到的命中
+		log.Printf("[search] 读取文件失败 %s: %v", t.path, err)
+	}
+	if single == nil && !state.satisfied() {
+		return nil
+	}
+	matches := groupMatches(t, g.groups, p.maxBytes)
+	if binary {
+		markBinary(matches)
+	}
 	return matches
 }
 
-func buildSnippet(filePath string, matchLine int, matchContent string, maxLines int) string {
-	f, err := os.Open(filePath)
-	if err != nil {
-		return strings.TrimSpace(matchContent)
+func markBinary(matches []Match) {
+	for i := range matches {
+		matches[i].Binary = true
 	}
-	defer f.Close()
+}
 
-	var lines []string
-	sc := bufio.NewScanner(f)
-	lineNum := 0
-	for sc.Scan() {
-		lineNum++
-		if lineNum > matchLine+maxLines/2 {
-			break
-		}
-		if lineNum >= matchLine-maxLines/2 {
-			lines = append(lines, sc.Text())
+// contextLines returns the context lines before and after a hit: ContextBefore / ContextAfter when set
+// (clamped to 0..maxContextLines), defaultContextLines otherwise.
+func (p Params) contextLines() (int, int) {
+	clamp := func(n *int) int {
+		if n == nil {
+			return defaultContextLines
 		}
+		return min(max(*n, 0), maxContextLines)
 	}
-	if sc.Err() != nil {
-		return strings.TrimSpace(matchContent)
-	}
-	if len(lines) == 0 {
-		return strings.TrimSpace(matchContent)
-	}
-	if len(lines) > maxLines {
-		lines = lines[:maxLines]
-	}
-	return strings.Join(lines, "\n")
+	return clamp(p.ContextBefore), clamp(p.ContextAfter)
 }
@@ -0,0 +1,299 @@
+package search
+
+import (
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	maxSnippetLineBytes = 400 // longer snippet lines (minified files) are clipped
+	clipMarginBytes     = 100 // kept before the hit on a clipped line
+	clipMarker          = "…"
+)
+
+// lineHit is a matching line of a file with the byte ranges of its hits.
+type lineHit struct {
+	num  int
+	text string
+	locs [][]int
+}
+
+// hitGroup is one snippet: hits whose context windows touch or overlap, and the snippet lines from start.
+type hitGroup struct {
+	hits  []lineHit
+	start int      // first line of the snippet
+	end   int      // last hit + context after; the file may end earlier
+	lines []string // snippet lines from start, as far as collected
+}
+
+// hitGrouper collects the hits of one file, in line order, into groups whose context windows touch or
+// overlap; each group becomes one snippet (at most maxMergedLines long, unless the context alone is longer).
+//
+// With collect, the grouper is fed every line of the file (line) and cuts the snippets while the file is
+// scanned, keeping only the last before+1 lines in a ring buffer, so a file is read once whatever the number
+// of hits. Without it, readSnippets fills the snippets afterwards, in one more pass over the file.
+type hitGrouper struct {
+	before, after int
+	groups        []*hitGroup
+	open          int // groups[open:] still take lines
+	collect       bool
+	ring          lineRing
+}
+
+func newHitGrouper(before, after int, collect bool) *hitGrouper {
+	g := &hitGrouper{before: before, after: after, collect: collect}
+	if collect {
+		g.ring = newLineRing(before + 1)
+	}
+	return g
+}
+
+// line feeds the next line of the file (collect mode); call it before add for a hit on that line.
+func (g *hitGrouper) line(num int, text string) {
+	for _, grp := range g.groups[g.open:] {
+		if num <= grp.end {
+			grp.lines = append(grp.lines, text)
+		}
+	}
+	// group ends grow with their index, so closed groups form a prefix
+	for g.open < len(g.groups) && g.groups[g.open].end <= num {
+		g.open++
+	}
+	g.ring.push(num, text)
+}
+
+// joins reports whether h would be merged into the last group.
+func (g *hitGrouper) joins(h lineHit) bool {
+	if len(g.groups) == 0 {
+		return false
+	}
+	grp := g.groups[len(g.groups)-1]
+	span := h.num + g.after - grp.start + 1
+	return g.mayJoin(h.num) && span <= max(maxMergedLines, g.before+g.after+1)
+}
+
+// mayJoin reports whether the context window of a hit on line num would touch the last group.
+func (g *hitGrouper) mayJoin(num int) bool {
+	if len(g.groups) == 0 {
+		return false
+	}
+	grp := g.groups[len(g.groups)-1]
+	return num-g.before <= grp.hits[len(grp.hits)-1].num+g.after+1
+}
+
+// complete reports whether every snippet has all its lines (collect mode, after line).
+func (g *hitGrouper) complete() bool {
+	return g.open == len(g.groups)
+}
+
+func (g *hitGrouper) add(h lineHit) {
+	if g.joins(h) {
+		last := len(g.groups) - 1
+		grp := g.groups[last]
+		if g.collect {
+			// the group may have been closed at its old end: the lines up to h are still in the ring,
+			// since h's context before reaches back to the group
+			grp.lines = append(grp.lines, g.ring.since(grp.start+len(grp.lines))...)
+			g.open = min(g.open, last)
+		}
+		grp.hits = append(grp.hits, h)
+		grp.end = h.num + g.after
+		return
+	}
+	grp := &hitGroup{hits: []lineHit{h}, start: max(h.num-g.before, 1), end: h.num + g.after}
+	if g.collect {
+		grp.lines = g.ring.since(grp.start)
+	}
+	g.groups = append(g.groups, grp)
+}
+
+// readSnippets fills the lines of groups (in line order) with one read of the file and returns the groups
+// kept. Like searchFile, the read stops at a line with a NUL byte: binary is set, snippets end before that line
+// and groups from it on are dropped. With skipGenerated, a file starting with a generated-file marker keeps no
+// groups.
+func readSnippets(path string, groups []*hitGroup, skipGenerated bool) (kept []*hitGroup, binary bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return groups, false
+	}
+	defer f.Close()
+	lr := newLineReader(f)
+	if skipGenerated && isGeneratedHead(lr.head(binarySniffBytes)) {
+		return nil, false
+	}
+	lo, num := 0, 0
+	for lo < len(groups) {
+		line, ok := lr.next()
+		if !ok {
+			break
+		}
+		num++
+		if strings.IndexByte(line, 0) >= 0 {
+			binary = true
+			break
+		}
+		for lo < len(groups) && groups[lo].end < num {
+			lo++
+		}
+		for _, grp := range groups[lo:] {
+			if grp.start > num {
+				break
+			}
+			grp.lines = append(grp.lines, line)
+		}
+	}
+	if binary {
+		for i, grp := range groups {
+			k := 0
+			for k < len(grp.hits) && grp.hits[k].num < num {
+				k++
+			}
+			if k == 0 {
+				return groups[:i], true
+			}
+			grp.hits = grp.hits[:k]
+		}
+	}
+	return groups, binary
+}
+
+// lineRing keeps the last lines read in a fixed-size ring buffer.
+type lineRing struct {
+	nums  []int // 0: empty slot
+	texts []string
+	next  int
+}
+
+func newLineRing(n int) lineRing {
+	return lineRing{nums: make([]int, n), texts: make([]string, n)}
+}
+
+func (r *lineRing) push(num int, text string) {
+	if len(r.nums) == 0 {
+		return
+	}
+	r.nums[r.next], r.texts[r.next] = num, text
+	r.next = (r.next + 1) % len(r.nums)
+}
+
+// since returns the buffered lines numbered from on, in order.
+func (r *lineRing) since(from int) []string {
+	var out []string
+	for i := range r.nums {
+		k := (r.next + i) % len(r.nums)
+		if r.nums[k] > 0 && r.nums[k] >= from {
+			out = append(out, r.texts[k])
+		}
+	}
+	return out
+}
+
+// groupMatches builds one match per group: the snippet runs from context before the first hit to context after
+// the last one, and MatchLines lists the hits. Lines longer than maxSnippetLineBytes are clipped around their
+// first hit (context lines: to their head) and the match is flagged Minified; columns still count in the whole
+// line. Matches stop once maxBytes of output is reached.
+func groupMatches(t scanTarget, groups []*hitGroup, maxBytes int) []Match {
+	var matches []Match
+	fileBytes := 0
+	for _, grp := range groups {
+		if fileBytes >= maxBytes {
+			break
+		}
+		first, last := grp.hits[0], grp.hits[len(grp.hits)-1]
+		lines, start := grp.lines, grp.start
+		if len(lines) == 0 { // file could not be read again
+			lines, start = []string{first.text}, first.num
+		}
+		clipped := false
+		out := make([]string, len(lines))
+		for i, k := 0, 0; i < len(lines); i++ {
+			var loc []int
+			for k < len(grp.hits) && grp.hits[k].num < start+i {
+				k++
+			}
+			if k < len(grp.hits) && grp.hits[k].num == start+i && len(grp.hits[k].locs) > 0 {
+				loc = grp.hits[k].locs[0]
+			}
+			var c bool
+			out[i], c = clipLine(lines[i], loc)
+			clipped = clipped || c
+		}
+		snippet, end := strings.Join(out, "\n"), start+len(lines)-1
+		if snippet == "" {
+			continue
+		}
+		m := Match{
+			Path:        t.path,
+			LineStart:   start,
+			LineEnd:     end,
+			Snippet:     snippet,
+			MatchReason: "content",
+			MatchLines:  make([]int, len(grp.hits)),
+			Minified:    clipped,
+			dirIdx:      t.dirIdx,
+			line:        last.num,
+			texts:       make([]string, len(grp.hits)),
+		}
+		for i, h := range grp.hits {
+			m.MatchLines[i], m.texts[i] = h.num, h.text
+			for _, loc := range h.locs[:min(len(h.locs), maxLineSubmatches)] {
+				m.Submatches = append(m.Submatches, Submatch{Line: h.num, Columns: lineColumns(h.text, loc)})
+			}
+		}
+		if len(m.Submatches) > 0 {
+			m.Columns = m.Submatches[0].Columns
+		}
+		matches = append(matches, m)
+		fileBytes += len(t.path) + len(snippet) + 64
+	}
+	return matches
+}
+
+// clipLine shortens a line longer than maxSnippetLineBytes to a window starting clipMarginBytes before the
+// byte range loc (at the head of the line when loc is nil), marking the cut ends with clipMarker.
+func clipLine(line string, loc []int) (string, bool) {
+	if len(line) <= maxSnippetLineBytes {
+		return line, false
+	}
+	start := 0
+	if loc != nil {
+		start = max(min(loc[0]-clipMarginBytes, len(line)-maxSnippetLineBytes), 0)
+	}
+	end := start + maxSnippetLineBytes
+	for start > 0 && !utf8.RuneStart(line[start]) {
+		start++
+	}
+	for end < len(line) && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	out := line[start:end]
+	if start > 0 {
+		out = clipMarker + out
+	}
+	if end < len(line) {
+		out += clipMarker
+	}
+	return out, true
+}
+
+// lineColumns converts the byte range loc of line to Columns.
+func lineColumns(line string, loc []int) Columns {
+	start := utf16Len(line[:loc[0]])
+	return Columns{
+		ColumnStart:      loc[0],
+		ColumnEnd:        loc[1],
+		ColumnStartUTF16: start,
+		ColumnEndUTF16:   start + utf16Len(line[loc[0]:loc[1]]),
+	}
+}
+
+// utf16Len returns the length of s in UTF-16 code units; invalid UTF-8 bytes count as one unit each.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
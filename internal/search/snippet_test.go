@@ -0,0 +1,94 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// benchFile writes a file of n lines with a hit on every step-th line, and returns its path with the hits.
+func benchFile(b *testing.B, n, step int) (string, *query, []lineHit) {
+	b.Helper()
+	q, err := compileQuery(Params{Query: "needle"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	var sb strings.Builder
+	var hits []lineHit
+	for i := 1; i <= n; i++ {
+		line := "\tvalue := compute(input, options) // filler line of ordinary length"
+		if i%step == 0 {
+			line = "\tresult := needle(value) // hit"
+			hits = append(hits, lineHit{num: i, text: line, locs: q.and[0].FindAll(line)})
+		}
+		sb.WriteString(line + "\n")
+	}
+	path := filepath.Join(b.TempDir(), "big.go")
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		b.Fatal(err)
+	}
+	return path, q, hits
+}
+
+// BenchmarkSearchFile: built-in engine, snippets cut while scanning (one read per file).
+func BenchmarkSearchFile(b *testing.B) {
+	path, q, _ := benchFile(b, 200000, 20)
+	p := Params{Limit: 1 << 30, maxBytes: 1 << 30}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(searchFile(scanTarget{path: path}, q, p)) == 0 {
+			b.Fatal("no matches")
+		}
+	}
+}
+
+// BenchmarkRgSnippets: rg engine, the hits rg reported for a file grouped and filled in one read.
+func BenchmarkRgSnippets(b *testing.B) {
+	path, _, hits := benchFile(b, 20000, 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g := newHitGrouper(defaultContextLines, defaultContextLines, false)
+		for _, h := range hits {
+			g.add(h)
+		}
+		readSnippets(path, g.groups, true)
+		groupMatches(scanTarget{path: path}, g.groups, 1<<30)
+	}
+}
+
+// BenchmarkRgSnippetsPerGroup is the cost of reading the file again for every snippet, as done before
+// snippets were cut in a single pass; compare with BenchmarkRgSnippets.
+func BenchmarkRgSnippetsPerGroup(b *testing.B) {
+	path, _, hits := benchFile(b, 20000, 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g := newHitGrouper(defaultContextLines, defaultContextLines, false)
+		for _, h := range hits {
+			g.add(h)
+		}
+		for _, grp := range g.groups {
+			readSnippets(path, []*hitGroup{grp}, true)
+		}
+		groupMatches(scanTarget{path: path}, g.groups, 1<<30)
+	}
+}
+
+// BenchmarkSearchFileMinified: one 8MB line with many hits, as in minified bundles.
+func BenchmarkSearchFileMinified(b *testing.B) {
+	q, err := compileQuery(Params{Query: "needle"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(b.TempDir(), "bundle.min.js")
+	if err := os.WriteFile(path, []byte(strings.Repeat("var a=b(c);needle(d);", 400000)+"\n"), 0644); err != nil {
+		b.Fatal(err)
+	}
+	p := Params{Limit: 1 << 30, maxBytes: 1 << 30}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(searchFile(scanTarget{path: path}, q, p)) == 0 {
+			b.Fatal("no matches")
+		}
+	}
+}
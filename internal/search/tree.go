@@ -0,0 +1,164 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultTreeDepth   = 2
+	maxTreeDepth       = 8
+	defaultTreeEntries = 200
+	maxTreeEntries     = 1000
+	maxTreeReads       = 50000 // directory entries ListTree reads at most, whatever the depth
+)
+
+// TreeParams for ListTree.
+type TreeParams struct {
+	Codebase   string // 目录名称或 ID
+	Path       string // 可选：相对 Codebase 的子路径；不指定 Codebase 时为绝对路径
+	Depth      int    // 展开的层数，默认 2
+	MaxEntries int    // 最多列出的条目数，默认 200
+	IgnorePath string
+}
+
+// TreeEntry is a file or directory of the tree returned by ListTree.
+type TreeEntry struct {
+	Name     string       `json:"name"`
+	Path     string       `json:"path"` // relative to the codebase root, slash-separated
+	Type     string       `json:"type"` // dir or file
+	Size     int64        `json:"size"` // dirs: total size of the files below, down to the depth read
+	Files    int          `json:"files,omitempty"`
+	Children []*TreeEntry `json:"children,omitempty"`
+	Omitted  int          `json:"omitted,omitempty"` // dirs: children not listed (depth limit or max_entries budget)
+
+	all   []*TreeEntry // every child, when within the depth limit
+	count int          // number of children
+}
+
+// TreeResult is the response of ListTree.
+type TreeResult struct {
+	Codebase  string     `json:"codebase"`
+	Root      *TreeEntry `json:"root"`
+	Entries   int        `json:"entries"`   // entries listed, root excluded
+	Truncated bool       `json:"truncated"` // the max_entries budget collapsed some directories, or the tree was too large to read in full
+}
+
+// ListTree returns the tree of a registered directory, or of a directory inside it, down to Depth levels.
+// Only those levels are read: the directories of the last one are read once to count their children, not
+// descended into, and files and sizes are counted over the directories read; ignored paths are left out.
+// Entries are listed breadth first until MaxEntries, so the upper levels stay complete; directories whose
+// children are not all listed carry the number left out in Omitted.
+func ListTree(p TreeParams) (*TreeResult, error) {
+	if p.Depth <= 0 {
+		p.Depth = defaultTreeDepth
+	}
+	if p.Depth > maxTreeDepth {
+		p.Depth = maxTreeDepth
+	}
+	if p.MaxEntries <= 0 {
+		p.MaxEntries = defaultTreeEntries
+	}
+	if p.MaxEntries > maxTreeEntries {
+		p.MaxEntries = maxTreeEntries
+	}
+	if p.Codebase == "" && p.Path == "" {
+		return nil, &QueryError{Code: "invalid_path", Message: "codebase or path is required"}
+	}
+	abs, dir, err := resolvePath(p.Path, p.Codebase, p.IgnorePath, true)
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Clean(dir.Path)
+	ignores := newDirIgnores(dir, loadIgnoreRules(p.IgnorePath))
+	rel := relSlash(root, abs)
+	// 从根目录起加载途经各级目录的忽略文件
+	ignores.enter("", root)
+	for i := strings.IndexByte(rel, '/'); i >= 0; i = nextSlash(rel, i) {
+		ignores.enter(rel[:i], filepath.Join(root, filepath.FromSlash(rel[:i])))
+	}
+	scan := &treeScan{ignores: ignores, depth: p.Depth, budget: maxTreeReads}
+	top := scan.dir(abs, rel, 0)
+
+	res := &TreeResult{Codebase: dir.Name, Root: top, Truncated: scan.cut}
+	queue := []*TreeEntry{top}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		for _, c := range d.all {
+			if res.Entries >= p.MaxEntries {
+				res.Truncated = true
+				break
+			}
+			d.Children = append(d.Children, c)
+			res.Entries++
+			if c.Type == "dir" {
+				c.Omitted = c.count
+				queue = append(queue, c)
+			}
+		}
+		d.Omitted = d.count - len(d.Children)
+	}
+	return res, nil
+}
+
+// treeScan is the walk of ListTree: ignore rules, depth and the budget of directory entries read.
+type treeScan struct {
+	ignores *dirIgnores
+	depth   int
+	budget  int  // entries that may still be read
+	cut     bool // the budget ran out: some directories were not read
+}
+
+// dir reads the directory abs at the given level. Its files count into Files and Size; its subdirectories are
+// read while level < depth and kept as children, at level depth they are only counted.
+func (s *treeScan) dir(abs, rel string, level int) *TreeEntry {
+	e := &TreeEntry{Name: filepath.Base(abs), Path: rel, Type: "dir"}
+	if s.budget <= 0 {
+		s.cut = true
+		return e
+	}
+	entries, err := os.ReadDir(abs)
+	if err != nil {
+		return e
+	}
+	s.budget -= len(entries)
+	s.ignores.enter(rel, abs)
+	for _, de := range entries {
+		path := filepath.Join(abs, de.Name())
+		childRel := de.Name()
+		if rel != "." {
+			childRel = rel + "/" + de.Name()
+		}
+		var c *TreeEntry
+		if de.IsDir() {
+			if s.ignores.excluded(childRel, true) {
+				continue
+			}
+			if level >= s.depth {
+				e.count++
+				continue
+			}
+			c = s.dir(path, childRel, level+1)
+			e.Files += c.Files
+			e.Size += c.Size
+		} else {
+			if s.ignores.excluded(childRel, false) {
+				continue
+			}
+			info, err := de.Info()
+			if err != nil {
+				continue
+			}
+			c = &TreeEntry{Name: de.Name(), Path: childRel, Type: "file", Size: info.Size()}
+			e.Files++
+			e.Size += c.Size
+		}
+		e.count++
+		if level < s.depth {
+			e.all = append(e.all, c)
+		}
+	}
+	return e
+}
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/qiuxsgit/codex-mcp/internal/db"
+)
+
+// TestListTreeStopsAtDepth: directories below Depth are not read, the last level only counts its children,
+// and the read budget cuts the walk short.
+func TestListTreeStopsAtDepth(t *testing.T) {
+	if err := db.Open(filepath.Join(t.TempDir(), "db.sqlite")); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	root := writeFixture(t, map[string]string{
+		".ignore":         "*.tmp\n",
+		"x.txt":           "x",
+		"a/y.txt":         "yy",
+		"a/skip.tmp":      "t",
+		"a/b/z.txt":       "zzz",
+		"a/b/c/w.txt":     "wwww",
+		"a/b/c/d/deep.go": "package d\n",
+	})
+	if _, err := db.AddDirectory("fixture", root, "go", "后端业务"); err != nil {
+		t.Fatal(err)
+	}
+	ignorePath := filepath.Join(t.TempDir(), "ignore")
+
+	res, err := ListTree(TreeParams{Codebase: "fixture", Depth: 1, IgnorePath: ignorePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top := res.Root
+	// .ignore, x.txt and a/y.txt are read; a/b is only counted
+	if top.Files != 3 || top.Size != int64(len("*.tmp\n")+3) || res.Truncated {
+		t.Errorf("root files=%d size=%d truncated=%v", top.Files, top.Size, res.Truncated)
+	}
+	var a *TreeEntry
+	for _, c := range top.Children {
+		if c.Name == "a" {
+			a = c
+		}
+	}
+	if a == nil || len(a.Children) != 0 || a.Omitted != 2 || a.Files != 1 {
+		t.Fatalf("a: %+v", a)
+	}
+
+	res, err = ListTree(TreeParams{Codebase: "fixture", Depth: 2, IgnorePath: ignorePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Root.Files != 4 {
+		t.Errorf("depth 2: root files=%d, want 4", res.Root.Files)
+	}
+
+	// a budget smaller than the tree leaves directories unread and flags the walk
+	ignores := newDirIgnores(db.Directory{Path: root}, &IgnoreRules{})
+	ignores.enter("", root)
+	scan := &treeScan{ignores: ignores, depth: 8, budget: 4}
+	if e := scan.dir(root, ".", 0); !scan.cut || e.Files != 3 {
+		t.Errorf("budget: cut=%v files=%d", scan.cut, e.Files)
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -13,7 +14,9 @@ import (
 	"github.com/qiuxsgit/codex-mcp/internal/config"
 	"github.com/qiuxsgit/codex-mcp/internal/db"
 	"github.com/qiuxsgit/codex-mcp/internal/git"
+	"github.com/qiuxsgit/codex-mcp/internal/index"
 	"github.com/qiuxsgit/codex-mcp/internal/mcp"
+	"github.com/qiuxsgit/codex-mcp/internal/search"
 )
 
 // Server holds config and serves HTTP.
@@ -24,13 +27,14 @@ type Server struct {
 	mcpHandler     *mcp.Handler
 }
 
-// New creates a new Server.
-func New(addr, ignoreFilePath string, adminFS http.FileSystem) *Server {
+// New creates a new Server. searchWorkers is the built-in engine's scanner pool size (<=0: GOMAXPROCS);
+// exposePaths lets list_codebases return absolute directory paths.
+func New(addr, ignoreFilePath string, searchWorkers int, exposePaths bool, adminFS http.FileSystem) *Server {
 	return &Server{
 		Addr:           addr,
 		IgnoreFilePath: ignoreFilePath,
 		AdminFS:        adminFS,
-		mcpHandler:     &mcp.Handler{IgnoreFilePath: ignoreFilePath},
+		mcpHandler:     &mcp.Handler{IgnoreFilePath: ignoreFilePath, SearchWorkers: searchWorkers, ExposePaths: exposePaths},
 	}
 }
 
@@ -42,6 +46,12 @@ func (s *Server) Router() http.Handler {
 	mux.HandleFunc("POST /mcp", s.mcpHandler.ServeStreamableHTTP)
 	// MCP REST endpoint (direct POST to tool)
 	mux.HandleFunc("POST /mcp/search_internal_codebase", s.mcpHandler.ServeSearch)
+	mux.HandleFunc("POST /mcp/find_definition", s.mcpHandler.ServeFindDefinition)
+	mux.HandleFunc("POST /mcp/find_references", s.mcpHandler.ServeFindReferences)
+	mux.HandleFunc("POST /mcp/find_files", s.mcpHandler.ServeFindFiles)
+	mux.HandleFunc("POST /mcp/read_file", s.mcpHandler.ServeReadFile)
+	mux.HandleFunc("POST /mcp/list_tree", s.mcpHandler.ServeListTree)
+	mux.HandleFunc("POST /mcp/list_codebases", s.mcpHandler.ServeListCodebases)
 
 	// Admin UI: /admin -> index.html; /admin/* -> static files via FileServer (CSS/JS must get correct Content-Type)
 	mux.HandleFunc("GET /admin", s.serveAdminIndex)
@@ -53,11 +63,16 @@ func (s *Server) Router() http.Handler {
 	mux.HandleFunc("DELETE /api/directories/{id}", s.apiDeleteDirectory)
 	mux.HandleFunc("PATCH /api/directories/{id}/enabled", s.apiSetDirectoryEnabled)
 	mux.HandleFunc("PATCH /api/directories/{id}/git", s.apiSetDirectoryGitInterval)
+	mux.HandleFunc("PATCH /api/directories/{id}/vcs-ignore", s.apiSetDirectoryVCSIgnore)
+	mux.HandleFunc("GET /api/directories/{id}/ignore", s.apiGetDirectoryIgnore)
+	mux.HandleFunc("PUT /api/directories/{id}/ignore", s.apiPutDirectoryIgnore)
 	mux.HandleFunc("POST /api/directories/{id}/git/pull", s.apiDirectoryGitPull)
 
 	// API: ignore file (gitignore format)
 	mux.HandleFunc("GET /api/ignore-file", s.apiGetIgnoreFile)
 	mux.HandleFunc("PUT /api/ignore-file", s.apiPutIgnoreFile)
+	mux.HandleFunc("POST /api/ignore-file/test", s.apiTestIgnoreFile)
+	mux.HandleFunc("GET /api/ignore/explain", s.apiExplainIgnore)
 
 	return mux
 }
@@ -154,6 +169,9 @@ func (s *Server) apiAddDirectory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "add failed", http.StatusBadRequest)
 		return
 	}
+	if dir, err := db.GetDirectoryByID(id); err == nil && dir != nil {
+		search.RefreshIndex(*dir)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]int64{"id": id})
 }
@@ -174,6 +192,8 @@ func (s *Server) apiDeleteDirectory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
+	index.Remove(id)
+	search.RemoveDirectoryRules(id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -203,6 +223,90 @@ func (s *Server) apiSetDirectoryEnabled(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *Server) apiSetDirectoryVCSIgnore(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	if idStr == "" {
+		http.Error(w, "id required", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		UseVCSIgnore bool `json:"use_vcs_ignore"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if err := db.SetDirectoryUseVCSIgnore(id, body.UseVCSIgnore); err != nil {
+		log.Printf("[api] set vcs ignore: %v", err)
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// directoryFromPath returns the directory named by the {id} path value; on failure it has written the error.
+func directoryFromPath(w http.ResponseWriter, r *http.Request) *db.Directory {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return nil
+	}
+	dir, err := db.GetDirectoryByID(id)
+	if err != nil {
+		log.Printf("[api] get directory: %v", err)
+		http.Error(w, "get failed", http.StatusInternalServerError)
+		return nil
+	}
+	if dir == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil
+	}
+	return dir
+}
+
+func (s *Server) apiGetDirectoryIgnore(w http.ResponseWriter, r *http.Request) {
+	dir := directoryFromPath(w, r)
+	if dir == nil {
+		return
+	}
+	content, err := db.GetDirectoryIgnoreRules(dir.ID)
+	if err != nil {
+		log.Printf("[api] read directory ignore rules: %v", err)
+		http.Error(w, "read failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(content))
+}
+
+func (s *Server) apiPutDirectoryIgnore(w http.ResponseWriter, r *http.Request) {
+	dir := directoryFromPath(w, r)
+	if dir == nil {
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "body read failed", http.StatusBadRequest)
+		return
+	}
+	if err := db.SetDirectoryIgnoreRules(dir.ID, string(data)); err != nil {
+		log.Printf("[api] write directory ignore rules: %v", err)
+		http.Error(w, "write failed", http.StatusInternalServerError)
+		return
+	}
+	if err := search.UpdateDirectoryRules(dir.ID); err != nil {
+		log.Printf("[api] reload directory ignore rules: %v", err)
+		http.Error(w, "reload failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *Server) apiGetIgnoreFile(w http.ResponseWriter, r *http.Request) {
 	if s.IgnoreFilePath == "" {
 		http.Error(w, "ignore file not configured", http.StatusNotFound)
@@ -218,6 +322,7 @@ func (s *Server) apiGetIgnoreFile(w http.ResponseWriter, r *http.Request) {
 		data = []byte{}
 	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Ignore-Version", strconv.FormatUint(search.GlobalIgnore(s.IgnoreFilePath).Version(), 10))
 	w.Write(data)
 }
 
@@ -236,9 +341,80 @@ func (s *Server) apiPutIgnoreFile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "write failed", http.StatusInternalServerError)
 		return
 	}
+	// 立即生效，不等文件监听
+	version := search.GlobalIgnore(s.IgnoreFilePath).Reload()
+	w.Header().Set("X-Ignore-Version", strconv.FormatUint(version, 10))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// apiTestIgnoreFile is a dry run of PUT /api/ignore-file: it reports which files the candidate content would
+// newly exclude or include, in one directory or in every enabled one. Nothing is saved.
+func (s *Server) apiTestIgnoreFile(w http.ResponseWriter, r *http.Request) {
+	if s.IgnoreFilePath == "" {
+		http.Error(w, "ignore file not configured", http.StatusNotFound)
+		return
+	}
+	var body struct {
+		Content     string `json:"content"`
+		DirectoryID int64  `json:"directory_id"` // 可选：0 表示所有已启用目录
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	var dirs []db.Directory
+	if body.DirectoryID != 0 {
+		dir, err := db.GetDirectoryByID(body.DirectoryID)
+		if err != nil {
+			log.Printf("[api] get directory: %v", err)
+			http.Error(w, "get failed", http.StatusInternalServerError)
+			return
+		}
+		if dir == nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		dirs = []db.Directory{*dir}
+	} else {
+		list, err := db.ListEnabledDirectories()
+		if err != nil {
+			log.Printf("[api] list directories: %v", err)
+			http.Error(w, "list failed", http.StatusInternalServerError)
+			return
+		}
+		dirs = list
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"directories": search.DiffIgnoreRules([]byte(body.Content), s.IgnoreFilePath, dirs)})
+}
+
+// apiExplainIgnore reports the rule (and its source) that decides whether ?path= is searched. path is absolute,
+// or relative to ?codebase= (name or id).
+func (s *Server) apiExplainIgnore(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "path required", http.StatusBadRequest)
+		return
+	}
+	e, err := search.ExplainIgnore(path, r.URL.Query().Get("codebase"), s.IgnoreFilePath)
+	if err != nil {
+		var qe *search.QueryError
+		if !errors.As(err, &qe) {
+			log.Printf("[api] explain ignore: %v", err)
+			http.Error(w, "explain failed", http.StatusInternalServerError)
+			return
+		}
+		code := http.StatusBadRequest
+		if qe.Code == "not_found" {
+			code = http.StatusNotFound
+		}
+		http.Error(w, qe.Message, code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(e)
+}
+
 func (s *Server) apiSetDirectoryGitInterval(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	if idStr == "" {
@@ -299,6 +475,7 @@ func (s *Server) apiDirectoryGitPull(w http.ResponseWriter, r *http.Request) {
 	if err := db.UpdateDirectoryGitLastUpdated(id, now); err != nil {
 		log.Printf("[api] update git last updated: %v", err)
 	}
+	search.RefreshIndex(*dir)
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{"git_last_updated_at": now.Format(time.RFC3339)})
 }
@@ -0,0 +1,349 @@
+package symbols
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Scopes a rule may match in, as a bit set.
+const (
+	inTop   = 1 << iota // file top level, or directly in a module / namespace body
+	inType              // directly in a class / struct / interface / impl ... body
+	inLocal             // inside a function body or an anonymous block
+
+	anywhere = inTop | inType | inLocal
+)
+
+// rule is a ctags-style definition pattern, matched against a line with comments and strings blanked out.
+// Named groups: name (the defined name), kind (optional, mapped through kindNames), ret (Java return type:
+// a method without one is a constructor), recv (Kotlin extension receiver, used as the container).
+type rule struct {
+	re          *regexp.Regexp
+	kind        string          // kind when the pattern has no kind group
+	scope       int             // where the rule applies
+	onlyIn      map[string]bool // if set, the enclosing container must have one of these kinds
+	defaultName string          // name when the name group is empty (Kotlin companion object)
+}
+
+// braceLang is a language whose blocks are delimited by braces.
+type braceLang struct {
+	lex   *lexSpec
+	rules []rule
+}
+
+// kindImpl marks Rust impl blocks: they name the container of their methods but are not definitions themselves.
+const kindImpl = "impl"
+
+var kindNames = map[string]string{
+	"class": KindClass, "interface": KindInterface, "enum": KindEnum, "record": KindRecord, "@interface": KindAnnotation,
+	"enum class": KindEnum, "annotation class": KindAnnotation, "object": KindObject,
+	"struct": KindStruct, "trait": KindTrait, "union": KindUnion, "type": KindType,
+	"mod": KindModule, "module": KindModule, "namespace": KindModule,
+	"const": KindConst, "static": KindVariable,
+}
+
+// containerKinds are kinds whose body holds members (methods, fields); modules hold top-level declarations.
+var containerKinds = map[string]bool{
+	KindClass: true, KindInterface: true, KindEnum: true, KindRecord: true, KindAnnotation: true, KindObject: true,
+	KindStruct: true, KindTrait: true, KindUnion: true, kindImpl: true, KindModule: true,
+}
+
+// notNames are keywords that member patterns could otherwise take for a method name (e.g. "if (").
+var notNames = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true, "new": true, "throw": true,
+	"else": true, "do": true, "try": true, "super": true, "this": true, "typeof": true, "await": true, "yield": true,
+	"function": true, "synchronized": true, "when": true, "in": true, "is": true, "as": true, "delete": true, "void": true,
+}
+
+const (
+	javaAnnotations = `(?:@[\w.]+(?:\([^)]*\))?\s+)*`
+	javaModifiers   = `(?:(?:public|protected|private|static|final|abstract|sealed|non-sealed|strictfp|synchronized|native|default|transient|volatile)\s+)*`
+	ktModifiers     = `(?:(?:public|private|protected|internal|open|abstract|sealed|data|inner|value|inline|expect|actual|final|override|suspend|operator|infix|tailrec|external|const|lateinit)\s+)*`
+	tsPrefix        = `^\s*(?:export\s+)?(?:default\s+)?(?:declare\s+)?`
+	rsVisibility    = `(?:pub(?:\s*\([^)]*\))?\s+)?`
+)
+
+var cStyleLex = &lexSpec{
+	lineComment:  []string{"//"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes:       []string{`"""`, `"`, `'`},
+	multiline:    map[string]bool{`"""`: true},
+}
+
+var braceLangs = map[string]*braceLang{
+	"java": {
+		lex: cStyleLex,
+		rules: []rule{
+			{re: regexp.MustCompile(`^\s*` + javaAnnotations + javaModifiers + `(?P<kind>class|interface|enum|record|@interface)\s+(?P<name>[\w$]+)`), scope: anywhere},
+			{re: regexp.MustCompile(`^\s*` + javaAnnotations + javaModifiers + `(?:<[^>]*>\s*)?(?:(?P<ret>[\w$.]+(?:<.*>)?(?:\[\])*)\s+)?(?P<name>[\w$]+)\s*\(`), kind: KindMethod, scope: inType},
+			{re: regexp.MustCompile(`^\s*` + javaAnnotations + javaModifiers + `[\w$.]+(?:<.*>)?(?:\[\])*\s+(?P<name>[\w$]+)\s*(?:=|;|,|\[)`), kind: KindField, scope: inType},
+		},
+	},
+	"kotlin": {
+		lex: cStyleLex,
+		rules: []rule{
+			{re: regexp.MustCompile(`^\s*` + javaAnnotations + ktModifiers + `(?:fun\s+)?(?P<kind>enum\s+class|annotation\s+class|class|interface|object)\s+(?P<name>\w+)`), scope: anywhere},
+			{re: regexp.MustCompile(`^\s*` + ktModifiers + `companion\s+object(?:\s+(?P<name>\w+))?`), kind: KindObject, scope: inType, defaultName: "Companion"},
+			{re: regexp.MustCompile(`^\s*` + javaAnnotations + ktModifiers + `fun\s+(?:<[^>]*>\s*)?(?:(?P<recv>[\w.]+(?:<[^>]*>)?\??)\.)?(?P<name>\w+)\s*\(`), kind: KindFunction, scope: anywhere},
+			{re: regexp.MustCompile(`^\s*` + javaAnnotations + ktModifiers + `(?:val|var)\s+(?:<[^>]*>\s*)?(?:(?P<recv>[\w.]+(?:<[^>]*>)?\??)\.)?(?P<name>\w+)`), kind: KindProperty, scope: inTop | inType},
+			{re: regexp.MustCompile(`^\s*` + ktModifiers + `typealias\s+(?P<name>\w+)`), kind: KindType, scope: inTop | inType},
+		},
+	},
+	"ts": tsLang,
+	"js": tsLang,
+	"rust": {
+		lex: &lexSpec{
+			lineComment:  []string{"//"},
+			blockComment: [2]string{"/*", "*/"},
+			quotes:       []string{`"`, `'`},
+			multiline:    map[string]bool{`"`: true},
+			rustChars:    true,
+		},
+		rules: []rule{
+			{re: regexp.MustCompile(`^\s*` + rsVisibility + `(?:(?:const|async|unsafe|default|extern(?:\s+"[^"]*")?)\s+)*fn\s+(?P<name>\w+)`), kind: KindFunction, scope: anywhere},
+			{re: regexp.MustCompile(`^\s*` + rsVisibility + `(?:unsafe\s+)?(?P<kind>struct|enum|trait|union|type|mod)\s+(?P<name>\w+)`), scope: anywhere},
+			{re: regexp.MustCompile(`^\s*` + rsVisibility + `(?P<kind>const|static)\s+(?:mut\s+)?(?P<name>\w+)\s*:`), scope: inTop | inType},
+			{re: regexp.MustCompile(`^\s*macro_rules!\s*(?P<name>\w+)`), kind: KindMacro, scope: anywhere},
+			{re: regexp.MustCompile(`^\s*(?:unsafe\s+)?impl\b(?:\s*<.*?>)?\s+(?:!?[\w:]+(?:<.*?>)?\s+for\s+)?(?:&\s*)?(?:dyn\s+)?(?P<name>[\w:]+)`), kind: kindImpl, scope: anywhere},
+			{re: regexp.MustCompile(`^\s*` + rsVisibility + `(?P<name>[a-z_]\w*)\s*:(?:[^:]|$)`), kind: KindField, scope: inType, onlyIn: map[string]bool{KindStruct: true, KindUnion: true}},
+		},
+	},
+}
+
+// tsLang covers TypeScript and JavaScript; TS-only syntax in the patterns is optional.
+var tsLang = &braceLang{
+	lex: &lexSpec{
+		lineComment:  []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`"`, `'`, "`"},
+		multiline:    map[string]bool{"`": true},
+	},
+	rules: []rule{
+		{re: regexp.MustCompile(tsPrefix + `(?:abstract\s+)?(?:const\s+)?(?P<kind>class|interface|enum|namespace|module)\s+(?P<name>[\w$]+)`), scope: anywhere},
+		{re: regexp.MustCompile(tsPrefix + `type\s+(?P<name>[\w$]+)\s*(?:<[^=]*>)?\s*=`), kind: KindType, scope: anywhere},
+		{re: regexp.MustCompile(tsPrefix + `(?:async\s+)?function\b\s*\*?\s*(?P<name>[\w$]+)`), kind: KindFunction, scope: anywhere},
+		{re: regexp.MustCompile(tsPrefix + `(?:const|let|var)\s+(?P<name>[\w$]+)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|(?:<[^>]*>\s*)?\([^)]*\)\s*(?::[^=]+)?=>|[\w$]+\s*=>)`), kind: KindFunction, scope: inTop},
+		{re: regexp.MustCompile(tsPrefix + `(?:const|let|var)\s+(?P<name>[\w$]+)`), kind: KindVariable, scope: inTop},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|protected|static|readonly|abstract|async|override|declare|get|set|accessor)\s+)*\*?\s*(?P<name>#?[\w$]+)\s*[?!]?\s*(?:<[^>]*>)?\s*\(`), kind: KindMethod, scope: inType},
+		{re: regexp.MustCompile(`^\s*(?:(?:public|private|protected|static|readonly|abstract|override|declare|accessor)\s+)*(?P<name>#?[\w$]+)\s*[?!]?\s*(?::|=(?:[^=>]|$)|;)`), kind: KindProperty, scope: inType},
+	},
+}
+
+// openSym is a definition whose end has not been seen yet.
+type openSym struct {
+	idx     int // index in the output
+	kind    string
+	name    string
+	depth   int // block depth at the definition line
+	parens  int // open ( and [ since the definition line
+	angles  int // open type parameter brackets (< right after a name) since the definition line
+	candEnd int // > 0: the definition ends at this line unless the next code line continues it
+}
+
+// block is an open brace; owner is the definition whose body it is, nil for other blocks.
+type block struct {
+	owner *openSym
+}
+
+// extractBraces finds definitions line by line and follows braces to find where each one ends:
+// a definition with a body ends at its closing brace, one without ends at ';' or at the end of its
+// statement (the line is complete and the next code line does not continue it).
+func extractBraces(lang *braceLang, src []byte) []Symbol {
+	lx := &lexer{spec: lang.lex}
+	var out []Symbol
+	var stack []block
+	var head *openSym // definition whose body brace has not been seen yet
+	lastCode := 0
+	finish := func(s *openSym, line int) {
+		if line > out[s.idx].LineEnd {
+			out[s.idx].LineEnd = line
+		}
+	}
+	for i, raw := range splitLines(src) {
+		n := i + 1
+		code := lx.code(raw)
+		trimmed := strings.TrimSpace(code)
+		if trimmed == "" {
+			continue
+		}
+		if head != nil && head.candEnd > 0 {
+			if continuesStatement(trimmed) {
+				head.candEnd = 0
+			} else {
+				finish(head, head.candEnd)
+				head = nil
+			}
+		}
+		// inside a multi-line parameter list nothing starts a new definition
+		if s, ok := lang.match(code, stack); ok && (head == nil || head.parens <= 0) {
+			if head != nil {
+				finish(head, lastCode)
+			}
+			s.LineStart, s.LineEnd = n, n
+			out = append(out, s)
+			head = &openSym{idx: len(out) - 1, kind: s.Kind, name: s.Name, depth: len(stack)}
+		}
+		for k := 0; k < len(code); k++ {
+			switch code[k] {
+			case '(', '[':
+				if head != nil {
+					head.parens++
+				}
+			case ')', ']':
+				if head != nil {
+					head.parens--
+				}
+			case '<':
+				// C<T extends { r: number }>: braces in type parameters are not the body
+				if head != nil && k > 0 && isWordByte(code[k-1]) {
+					head.angles++
+				}
+			case '>':
+				if head != nil && head.angles > 0 {
+					head.angles--
+				}
+			case '{':
+				b := block{}
+				if head != nil && head.parens <= 0 && head.angles <= 0 {
+					b.owner, head = head, nil
+				}
+				stack = append(stack, b)
+			case '}':
+				if len(stack) > 0 {
+					b := stack[len(stack)-1]
+					stack = stack[:len(stack)-1]
+					if b.owner != nil {
+						finish(b.owner, n)
+					}
+				}
+				if head != nil && len(stack) < head.depth {
+					finish(head, lastCode) // the enclosing block closed first
+					head = nil
+				}
+			case ';':
+				if head != nil && head.parens <= 0 && len(stack) == head.depth {
+					finish(head, n)
+					head = nil
+				}
+			}
+		}
+		if head != nil && head.parens <= 0 && !unfinishedStatement(trimmed) {
+			head.candEnd = n
+		}
+		lastCode = n
+	}
+	if head != nil {
+		finish(head, lastCode)
+	}
+	for _, b := range stack {
+		if b.owner != nil {
+			finish(b.owner, lastCode)
+		}
+	}
+	// impl blocks only served as containers
+	kept := out[:0]
+	for _, s := range out {
+		if s.Kind != kindImpl {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// match applies the rules to one code line, in order; the first rule that matches wins.
+func (l *braceLang) match(code string, stack []block) (Symbol, bool) {
+	where, owner := inTop, (*openSym)(nil)
+	var containers []string
+	for _, b := range stack {
+		if b.owner != nil && containerKinds[b.owner.kind] {
+			containers = append(containers, b.owner.name)
+		}
+	}
+	if len(stack) > 0 {
+		owner = stack[len(stack)-1].owner
+		switch {
+		case owner == nil:
+			where = inLocal
+		case owner.kind == KindModule:
+			where = inTop
+		case containerKinds[owner.kind]:
+			where = inType
+		default:
+			where = inLocal
+		}
+	}
+	for _, r := range l.rules {
+		if r.scope&where == 0 || (r.onlyIn != nil && (owner == nil || !r.onlyIn[owner.kind])) {
+			continue
+		}
+		m := r.re.FindStringSubmatch(code)
+		if m == nil {
+			continue
+		}
+		group := func(name string) string {
+			if i := r.re.SubexpIndex(name); i >= 0 {
+				return m[i]
+			}
+			return ""
+		}
+		s := Symbol{Kind: r.kind, Name: group("name"), Container: strings.Join(containers, ".")}
+		if s.Name == "" {
+			s.Name = r.defaultName
+		}
+		if k := group("kind"); k != "" {
+			s.Kind = kindNames[strings.Join(strings.Fields(k), " ")]
+		}
+		if s.Name == "" || s.Kind == "" || notNames[s.Name] {
+			continue
+		}
+		if s.Kind == kindImpl {
+			s.Name = s.Name[strings.LastIndex(s.Name, ":")+1:]
+		}
+		if recv := group("recv"); recv != "" {
+			s.Container = strings.TrimRight(strings.SplitN(recv, "<", 2)[0], "?")
+		}
+		switch {
+		case s.Kind == KindFunction && where == inType:
+			s.Kind = KindMethod
+		case s.Kind == KindMethod && s.Name == "constructor":
+			s.Kind = KindConstructor
+		case s.Kind == KindMethod && r.re.SubexpIndex("ret") >= 0 && group("ret") == "":
+			// Java: only a constructor has no return type
+			if len(containers) == 0 || containers[len(containers)-1] != s.Name {
+				continue
+			}
+			s.Kind = KindConstructor
+		}
+		return s, true
+	}
+	return Symbol{}, false
+}
+
+// continuesStatement reports whether a code line continues the previous one (Allman braces, where clauses, ...).
+func continuesStatement(trimmed string) bool {
+	for _, p := range []string{"{", ".", "?", ":", "=", "|", "&", "+", "-", ">", ")", "where ", "extends ", "implements ", "throws ", "with "} {
+		if strings.HasPrefix(trimmed, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// unfinishedStatement reports whether a code line obviously continues on the next line.
+func unfinishedStatement(trimmed string) bool {
+	for _, s := range []string{",", "(", "[", "=", ">", ":", "|", "&", "+", "-", ".", "?", "<"} {
+		if strings.HasSuffix(trimmed, s) {
+			return true
+		}
+	}
+	for _, w := range []string{"extends", "implements", "throws", "where"} {
+		if strings.HasSuffix(trimmed, " "+w) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,104 @@
+package symbols
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// extractGo parses src with go/parser. Files with syntax errors still yield the declarations parsed before the error.
+func extractGo(src []byte) []Symbol {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if f == nil {
+		return nil
+	}
+	var out []Symbol
+	add := func(kind, name, container string, from, to token.Pos) {
+		if name == "" || name == "_" {
+			return
+		}
+		out = append(out, Symbol{Kind: kind, Name: name, Container: container, LineStart: fset.Position(from).Line, LineEnd: fset.Position(to).Line})
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				add(KindMethod, d.Name.Name, recvTypeName(d.Recv.List[0].Type), d.Pos(), d.End())
+			} else {
+				add(KindFunction, d.Name.Name, "", d.Pos(), d.End())
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				// 非分组声明（type X struct{...}）从 type / var / const 关键字所在行算起
+				from, to := spec.Pos(), spec.End()
+				if !d.Lparen.IsValid() {
+					from, to = d.Pos(), d.End()
+				}
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					addGoType(add, s, from, to)
+				case *ast.ValueSpec:
+					kind := KindVariable
+					if d.Tok == token.CONST {
+						kind = KindConst
+					}
+					for _, n := range s.Names {
+						add(kind, n.Name, "", from, to)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// addGoType adds a type and its struct fields or interface methods.
+func addGoType(add func(kind, name, container string, from, to token.Pos), s *ast.TypeSpec, from, to token.Pos) {
+	name := s.Name.Name
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		add(KindStruct, name, "", from, to)
+		for _, field := range t.Fields.List {
+			if len(field.Names) == 0 {
+				// 嵌入字段：字段名即类型名
+				add(KindField, recvTypeName(field.Type), name, field.Pos(), field.End())
+			}
+			for _, n := range field.Names {
+				add(KindField, n.Name, name, field.Pos(), field.End())
+			}
+		}
+	case *ast.InterfaceType:
+		add(KindInterface, name, "", from, to)
+		for _, m := range t.Methods.List {
+			if _, ok := m.Type.(*ast.FuncType); !ok {
+				continue // embedded interface or type constraint
+			}
+			for _, n := range m.Names {
+				add(KindMethod, n.Name, name, m.Pos(), m.End())
+			}
+		}
+	default:
+		add(KindType, name, "", from, to)
+	}
+}
+
+// recvTypeName returns the type name of a receiver or embedded field: *T, T[P] and pkg.T give T.
+func recvTypeName(e ast.Expr) string {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return recvTypeName(t.X)
+	case *ast.IndexExpr:
+		return recvTypeName(t.X)
+	case *ast.IndexListExpr:
+		return recvTypeName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.ParenExpr:
+		return recvTypeName(t.X)
+	default:
+		return ""
+	}
+}
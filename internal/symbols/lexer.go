@@ -0,0 +1,159 @@
+package symbols
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// lexSpec describes the comment and string syntax of a language, just enough to blank them out of a line.
+type lexSpec struct {
+	lineComment  []string
+	blockComment [2]string       // open, close; empty when the language has none
+	quotes       []string        // string delimiters, longest first (`"""` before `"`)
+	multiline    map[string]bool // delimiters whose strings may span lines
+	rustChars    bool            // ' starts a char literal only when it closes right away, otherwise it is a lifetime
+}
+
+// lexer carries comment / string state from one line to the next.
+type lexer struct {
+	spec      *lexSpec
+	inComment bool
+	inString  string // delimiter of the string open at the end of the previous line
+}
+
+// Byte classes reported by lexer.split.
+const (
+	classCode    byte = 0
+	classComment byte = 'c'
+	classString  byte = 's'
+)
+
+// code returns line with comments and string contents replaced by spaces. String delimiters are kept and
+// byte offsets are unchanged, so regexes and brace counting see the shape of the code only.
+func (lx *lexer) code(line string) string {
+	code, _ := lx.split(line)
+	return code
+}
+
+// split is code plus the class of every byte of line (classCode, classComment or classString).
+func (lx *lexer) split(line string) (string, []byte) {
+	b := []byte(line)
+	mask := make([]byte, len(line))
+	class := classComment
+	blank := func(from, to int) {
+		for k := from; k < to; k++ {
+			b[k] = ' '
+			mask[k] = class
+		}
+	}
+	i := 0
+	for i < len(line) {
+		switch {
+		case lx.inComment:
+			class = classComment
+			closer := lx.spec.blockComment[1]
+			end := strings.Index(line[i:], closer)
+			if end < 0 {
+				blank(i, len(line))
+				return string(b), mask
+			}
+			blank(i, i+end+len(closer))
+			i += end + len(closer)
+			lx.inComment = false
+		case lx.inString != "":
+			class = classString
+			end := closingQuote(line, i, lx.inString)
+			if end < 0 {
+				blank(i, len(line))
+				i = len(line)
+				continue
+			}
+			blank(i, end)
+			i = end + len(lx.inString)
+			lx.inString = ""
+		default:
+			if hasPrefixAny(line[i:], lx.spec.lineComment) {
+				class = classComment
+				blank(i, len(line))
+				return string(b), mask
+			}
+			if open := lx.spec.blockComment[0]; open != "" && strings.HasPrefix(line[i:], open) {
+				class = classComment
+				blank(i, i+len(open))
+				i += len(open)
+				lx.inComment = true
+				continue
+			}
+			q := quoteAt(line[i:], lx.spec.quotes)
+			if q == "" {
+				i++
+				continue
+			}
+			if q == "'" && lx.spec.rustChars {
+				end := rustCharEnd(line, i)
+				if end < 0 {
+					i++ // lifetime, e.g. 'a
+					continue
+				}
+				class = classString
+				blank(i+1, end)
+				i = end + 1
+				continue
+			}
+			i += len(q)
+			lx.inString = q
+		}
+	}
+	if lx.inString != "" && !lx.spec.multiline[lx.inString] {
+		lx.inString = "" // unterminated single-line string
+	}
+	return string(b), mask
+}
+
+// closingQuote returns the index of the delimiter closing a string that continues at line[i:], or -1.
+func closingQuote(line string, i int, delim string) int {
+	for i < len(line) {
+		if line[i] == '\\' {
+			i += 2
+			continue
+		}
+		if strings.HasPrefix(line[i:], delim) {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+// rustCharEnd returns the index of the quote closing a char literal starting at line[i], or -1 for a lifetime.
+func rustCharEnd(line string, i int) int {
+	if i+1 < len(line) && line[i+1] == '\\' {
+		if end := strings.IndexByte(line[i+2:], '\''); end >= 0 {
+			return i + 2 + end
+		}
+		return -1
+	}
+	_, size := utf8.DecodeRuneInString(line[i+1:])
+	if j := i + 1 + size; size > 0 && j < len(line) && line[j] == '\'' {
+		return j
+	}
+	return -1
+}
+
+func quoteAt(s string, quotes []string) string {
+	for _, q := range quotes {
+		if strings.HasPrefix(s, q) {
+			return q
+		}
+	}
+	return ""
+}
+
+func hasPrefixAny(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package symbols
+
+import (
+	"regexp"
+	"strings"
+)
+
+var pyLex = &lexSpec{
+	lineComment: []string{"#"},
+	quotes:      []string{`"""`, `'''`, `"`, `'`},
+	multiline:   map[string]bool{`"""`: true, `'''`: true},
+}
+
+var (
+	pyDef   = regexp.MustCompile(`^\s*(?:async\s+)?def\s+(\w+)`)
+	pyClass = regexp.MustCompile(`^\s*class\s+(\w+)`)
+	// name = ... / name: T = ... / name: T (class attributes, dataclass fields)
+	pyAssign = regexp.MustCompile(`^\s*([A-Za-z_]\w*)\s*(?::\s*[^=\s][^=]*(?:=(?:[^=]|$))?|=(?:[^=]|$))`)
+)
+
+// pyBlock is an open def or class; it ends before the next statement indented at or left of it.
+type pyBlock struct {
+	idx    int // index in the output
+	indent int
+	class  bool
+	name   string
+	body   int // indent of the body, -1 until its first statement
+}
+
+// extractPython finds def / class blocks by indentation, plus module-level variables and class attributes.
+// Lines inside brackets, after a backslash or inside a multi-line string continue the current statement.
+func extractPython(src []byte) []Symbol {
+	lx := &lexer{spec: pyLex}
+	var out []Symbol
+	var stack []pyBlock
+	lastCode, parens, stmt := 0, 0, -1
+	cont := false
+	for i, raw := range splitLines(src) {
+		n := i + 1
+		inString := lx.inString != ""
+		code := lx.code(raw)
+		trimmed := strings.TrimSpace(code)
+		if trimmed == "" && !inString {
+			continue
+		}
+		if !inString && parens == 0 && !cont {
+			stmt = -1
+			indent := indentOf(raw)
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				out[stack[len(stack)-1].idx].LineEnd = lastCode
+				stack = stack[:len(stack)-1]
+			}
+			var top *pyBlock
+			if len(stack) > 0 {
+				top = &stack[len(stack)-1]
+				if top.body < 0 {
+					top.body = indent
+				}
+			}
+			var classes []string
+			for _, b := range stack {
+				if b.class {
+					classes = append(classes, b.name)
+				}
+			}
+			s := Symbol{Container: strings.Join(classes, "."), LineStart: n, LineEnd: n}
+			inClassBody := top != nil && top.class && top.body == indent
+			if m := pyDef.FindStringSubmatch(code); m != nil {
+				s.Kind, s.Name = KindFunction, m[1]
+				if inClassBody {
+					s.Kind = KindMethod
+				}
+				out = append(out, s)
+				stack = append(stack, pyBlock{idx: len(out) - 1, indent: indent, name: s.Name, body: -1})
+			} else if m := pyClass.FindStringSubmatch(code); m != nil {
+				s.Kind, s.Name = KindClass, m[1]
+				out = append(out, s)
+				stack = append(stack, pyBlock{idx: len(out) - 1, indent: indent, class: true, name: s.Name, body: -1})
+			} else if m := pyAssign.FindStringSubmatch(code); m != nil && (top == nil || inClassBody) && !notNames[m[1]] {
+				s.Kind, s.Name = KindVariable, m[1]
+				if inClassBody {
+					s.Kind = KindField
+				}
+				out = append(out, s)
+				stmt = len(out) - 1
+			}
+		}
+		for k := 0; k < len(code); k++ {
+			switch code[k] {
+			case '(', '[', '{':
+				parens++
+			case ')', ']', '}':
+				if parens > 0 {
+					parens--
+				}
+			}
+		}
+		cont = strings.HasSuffix(strings.TrimRight(code, " \t"), `\`)
+		if stmt >= 0 {
+			out[stmt].LineEnd = n
+		}
+		lastCode = n
+	}
+	for _, b := range stack {
+		out[b.idx].LineEnd = lastCode
+	}
+	return out
+}
+
+// indentOf returns the width of the leading whitespace of line, tabs counting to the next multiple of 8.
+func indentOf(line string) int {
+	w := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			w++
+		case '\t':
+			w = (w/8 + 1) * 8
+		default:
+			return w
+		}
+	}
+	return w
+}
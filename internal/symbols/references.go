@@ -0,0 +1,175 @@
+package symbols
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Reasons of a reference, most specific first. A line with several hits gets the first reason in this order.
+const (
+	ReasonDefinition = "definition"
+	ReasonImport     = "import"
+	ReasonCall       = "call"
+	ReasonTypeRef    = "type_ref"
+	ReasonReference  = "reference" // any other use: field access, assignment, argument, ...
+	ReasonString     = "string"
+	ReasonComment    = "comment"
+)
+
+var reasonRank = map[string]int{
+	ReasonDefinition: 0, ReasonImport: 1, ReasonCall: 2, ReasonTypeRef: 3, ReasonReference: 4, ReasonString: 5, ReasonComment: 6,
+}
+
+// Reference is a line that mentions a name as a whole identifier.
+type Reference struct {
+	Line   int
+	Text   string
+	Reason string
+}
+
+var goLex = &lexSpec{
+	lineComment:  []string{"//"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes:       []string{`"`, "`", `'`},
+	multiline:    map[string]bool{"`": true},
+}
+
+// importStarts match the first line of an import statement; it continues while brackets opened on it are open.
+var importStarts = map[string]*regexp.Regexp{
+	"go":     regexp.MustCompile(`^\s*import\b`),
+	"java":   regexp.MustCompile(`^\s*import\s`),
+	"kotlin": regexp.MustCompile(`^\s*import\s`),
+	"ts":     regexp.MustCompile(`^\s*import\b|^\s*export\s.*\bfrom\s|\brequire\s*\(`),
+	"js":     regexp.MustCompile(`^\s*import\b|^\s*export\s.*\bfrom\s|\brequire\s*\(`),
+	"python": regexp.MustCompile(`^\s*(?:from\s+\S+\s+)?import\s`),
+	"rust":   regexp.MustCompile(`^\s*(?:pub(?:\s*\([^)]*\))?\s+)?(?:use|extern\s+crate)\s`),
+}
+
+var (
+	// a call: name(, name<T>(, name::<T>(, name[T]( (Go generics), name!( (Rust macros)
+	callAfter = regexp.MustCompile(`^\s*(?:(?:::)?<[^()]*>|\[[^()\]]*\]|!)?\s*\(`)
+	// keywords that are followed by a type
+	typeBefore = regexp.MustCompile(`(?:\bextends|\bimplements|\binstanceof|\bthrows|->)\s*$`)
+)
+
+func lexerFor(lang string) *lexer {
+	switch lang {
+	case "":
+		return nil
+	case "go":
+		return &lexer{spec: goLex}
+	case "python":
+		return &lexer{spec: pyLex}
+	default:
+		return &lexer{spec: braceLangs[lang].lex}
+	}
+}
+
+// References returns the lines of src where name occurs as a whole identifier, each with the most specific
+// reason among its hits. Files of unsupported languages are scanned without comment, string, import or
+// definition detection.
+func References(path string, src []byte, name string) []Reference {
+	if name == "" || !bytes.Contains(src, []byte(name)) {
+		return nil
+	}
+	lang := Language(path)
+	lx := lexerFor(lang)
+	defLines := make(map[int]bool)
+	for _, s := range Extract(path, src) {
+		if s.Name == name {
+			defLines[s.LineStart] = true
+		}
+	}
+	importStart := importStarts[lang]
+	importDepth, inImport := 0, false
+
+	var out []Reference
+	for i, raw := range splitLines(src) {
+		n := i + 1
+		code, mask := raw, make([]byte, len(raw))
+		if lx != nil {
+			code, mask = lx.split(raw)
+		}
+		isImport := inImport
+		if !inImport && importStart != nil && importStart.MatchString(code) {
+			isImport, inImport, importDepth = true, true, 0
+		}
+		if inImport {
+			importDepth += strings.Count(code, "(") + strings.Count(code, "{") - strings.Count(code, ")") - strings.Count(code, "}")
+			if importDepth <= 0 {
+				inImport = false
+			}
+		}
+		reason := ""
+		for _, loc := range identifierHits(raw, name) {
+			r := classifyHit(code, mask, loc[0], loc[1], name)
+			switch {
+			case r == ReasonComment:
+			case isImport:
+				r = ReasonImport
+			case defLines[n] && r != ReasonString:
+				r = ReasonDefinition
+			}
+			if reason == "" || reasonRank[r] < reasonRank[reason] {
+				reason = r
+			}
+		}
+		if reason != "" {
+			out = append(out, Reference{Line: n, Text: raw, Reason: reason})
+		}
+	}
+	return out
+}
+
+// classifyHit classifies one hit line[s:e] from its byte classes and the code around it.
+func classifyHit(code string, mask []byte, s, e int, name string) string {
+	switch mask[s] {
+	case classComment:
+		return ReasonComment
+	case classString:
+		return ReasonString
+	}
+	after := code[e:]
+	if callAfter.MatchString(after) {
+		return ReasonCall
+	}
+	if typeBefore.MatchString(code[:s]) {
+		return ReasonTypeRef
+	}
+	// Capitalized names are types (User{}, List<User>, u: User), unless a member follows (User.find)
+	// or they are a member themselves (req.User), where only a composite literal (pkg.User{) is a type
+	r, _ := utf8.DecodeRuneInString(name)
+	if unicode.IsUpper(r) {
+		rest := strings.TrimLeft(after, " \t")
+		member := strings.HasSuffix(strings.TrimRight(code[:s], " \t"), ".")
+		if !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "::") && (!member || strings.HasPrefix(rest, "{")) {
+			return ReasonTypeRef
+		}
+	}
+	return ReasonReference
+}
+
+// identifierHits returns the byte ranges where name occurs in line not touching another identifier character.
+func identifierHits(line, name string) [][2]int {
+	var out [][2]int
+	for from := 0; ; {
+		i := strings.Index(line[from:], name)
+		if i < 0 {
+			return out
+		}
+		s, e := from+i, from+i+len(name)
+		before, _ := utf8.DecodeLastRuneInString(line[:s])
+		after, _ := utf8.DecodeRuneInString(line[e:])
+		if (s == 0 || !isIdentChar(before)) && (e == len(line) || !isIdentChar(after)) {
+			out = append(out, [2]int{s, e})
+		}
+		from = s + 1
+	}
+}
+
+func isIdentChar(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,117 @@
+package symbols
+
+import (
+	"reflect"
+	"testing"
+)
+
+// referenceCases give, per language, the reason References must report for every line mentioning name.
+var referenceCases = []struct {
+	lang string
+	path string
+	name string
+	src  string
+	want map[int]string // line -> reason
+}{
+	{"go", "x.go", "User", `package p
+
+import (
+	"fmt"
+	users "example.com/x/User"
+)
+
+// User is documented here.
+type User struct{ ID int }
+
+func NewUser() *User {
+	fmt.Println("User created")
+	return &User{}
+}
+
+func load(u User) { users.User(u) }
+var v = User{} // the User
+`, map[int]string{
+		5: ReasonImport, 8: ReasonComment, 9: ReasonDefinition, 11: ReasonTypeRef, 12: ReasonString, 13: ReasonTypeRef,
+		16: ReasonCall, 17: ReasonTypeRef,
+	}},
+	{"java", "X.java", "Repo", `import com.acme.data.Repo;
+import static com.acme.Repo.find;
+
+/** Repo docs */
+public class Service extends Repo implements Runnable {
+    private final Repo repo = new Repo();
+    String label = "Repo";
+    void run() { Repo.create(); }
+    <T extends Repo> T cast(Object o) { return (T) o; }
+}
+class Repo {}
+`, map[int]string{
+		1: ReasonImport, 2: ReasonImport, 4: ReasonComment, 5: ReasonTypeRef, 6: ReasonCall, 7: ReasonString,
+		8: ReasonReference, 9: ReasonTypeRef, 11: ReasonDefinition,
+	}},
+	{"kotlin", "x.kt", "Config", `import com.acme.Config as AppConfig
+
+fun load(): Config = Config("x")
+val c: Config? = null
+// Config
+`, map[int]string{1: ReasonImport, 3: ReasonCall, 4: ReasonTypeRef, 5: ReasonComment}},
+	{"typescript", "x.ts", "fetchUser", `import { fetchUser as getUser } from "./api";
+export { fetchUser } from "./api";
+const api = require("./fetchUser");
+
+export async function fetchUser(id: string) {
+  return ` + "`fetchUser ${id}`" + `;
+}
+// calls fetchUser
+const h = fetchUser;
+await fetchUser<User>("1");
+`, map[int]string{
+		1: ReasonImport, 2: ReasonImport, 3: ReasonImport, 5: ReasonDefinition, 6: ReasonString, 8: ReasonComment,
+		9: ReasonReference, 10: ReasonCall,
+	}},
+	{"python", "x.py", "load", `from mod import load as _load
+import pkg.load
+
+def load(path):
+    """load the file"""
+    # load it
+    return _load(path)
+
+x = load("a")
+f = load
+obj.load(1)
+`, map[int]string{
+		1: ReasonImport, 2: ReasonImport, 4: ReasonDefinition, 5: ReasonString, 6: ReasonComment, 9: ReasonCall,
+		10: ReasonReference, 11: ReasonCall,
+	}},
+	{"rust", "x.rs", "parse", `use crate::util::parse;
+use crate::util::{parse as p, other};
+
+/// parse docs
+pub fn parse(s: &str) -> u32 {
+    let r = parse::<u32>(s);
+    println!("parse {}", s);
+    r
+}
+let f = self::parse;
+`, map[int]string{
+		1: ReasonImport, 2: ReasonImport, 4: ReasonComment, 5: ReasonDefinition, 6: ReasonCall, 7: ReasonString,
+		10: ReasonReference,
+	}},
+	// no comment, string, import or definition detection for other languages
+	{"unsupported", "notes.md", "load", "see load() here\n# load\nreload\n", map[int]string{1: ReasonCall, 2: ReasonReference}},
+}
+
+func TestReferences(t *testing.T) {
+	for _, tc := range referenceCases {
+		t.Run(tc.lang, func(t *testing.T) {
+			got := make(map[int]string)
+			for _, r := range References(tc.path, []byte(tc.src), tc.name) {
+				got[r.Line] = r.Reason
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got  %v\nwant %v", got, tc.want)
+			}
+		})
+	}
+}
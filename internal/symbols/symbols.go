@@ -0,0 +1,91 @@
+// Package symbols extracts definitions (functions, methods, types, fields, ...) from source files.
+// Go is parsed with go/parser; Java, Kotlin, TypeScript/JavaScript, Python and Rust use ctags-style
+// regular expressions over lines whose comments and string contents have been blanked out.
+package symbols
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Symbol kinds.
+const (
+	KindFunction    = "function"
+	KindMethod      = "method"
+	KindConstructor = "constructor"
+	KindClass       = "class"
+	KindInterface   = "interface"
+	KindStruct      = "struct"
+	KindEnum        = "enum"
+	KindRecord      = "record"
+	KindTrait       = "trait"
+	KindObject      = "object"
+	KindAnnotation  = "annotation"
+	KindUnion       = "union"
+	KindType        = "type"
+	KindModule      = "module"
+	KindField       = "field"
+	KindProperty    = "property"
+	KindVariable    = "variable"
+	KindConst       = "const"
+	KindMacro       = "macro"
+)
+
+// Symbol is one definition in a file.
+type Symbol struct {
+	Kind      string
+	Name      string
+	Container string // enclosing type / class / impl / module, dot-separated when nested; "" at top level
+	LineStart int
+	LineEnd   int
+}
+
+// Language returns the language of path by extension, or "" when symbols cannot be extracted from it.
+func Language(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".go":
+		return "go"
+	case ".java":
+		return "java"
+	case ".kt", ".kts":
+		return "kotlin"
+	case ".ts", ".tsx", ".mts", ".cts":
+		return "ts"
+	case ".js", ".jsx", ".mjs", ".cjs":
+		return "js"
+	case ".py", ".pyi":
+		return "python"
+	case ".rs":
+		return "rust"
+	default:
+		return ""
+	}
+}
+
+// Extract returns the definitions in src, ordered by line. path only selects the language.
+func Extract(path string, src []byte) []Symbol {
+	var out []Symbol
+	switch lang := Language(path); lang {
+	case "":
+		return nil
+	case "go":
+		out = extractGo(src)
+	case "python":
+		out = extractPython(src)
+	default:
+		out = extractBraces(braceLangs[lang], src)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].LineStart < out[j].LineStart })
+	return out
+}
+
+// splitLines splits src into lines without their terminators ("\n" or "\r\n").
+func splitLines(src []byte) []string {
+	s := strings.ReplaceAll(string(src), "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
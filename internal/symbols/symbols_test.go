@@ -0,0 +1,288 @@
+package symbols
+
+import (
+	"reflect"
+	"testing"
+)
+
+// extractCases give, per language, a source file and every definition Extract must return: kind, name,
+// container and line range.
+var extractCases = []struct {
+	name string
+	path string
+	src  string
+	want []Symbol
+}{
+	{"go", "x.go", `package p
+
+type Box[T any] struct {
+	Value T
+	io.Reader
+}
+
+func (b *Box[T]) Get() T {
+	s := "}{"
+	return b.Value
+}
+
+type Getter interface {
+	Get() int
+	fmt.Stringer
+}
+
+const (
+	A = 1
+	B = 2
+)
+
+var x, y = 1, 2
+
+func F() {}
+`, []Symbol{
+		{KindStruct, "Box", "", 3, 6},
+		{KindField, "Value", "Box", 4, 4},
+		{KindField, "Reader", "Box", 5, 5},
+		{KindMethod, "Get", "Box", 8, 11},
+		{KindInterface, "Getter", "", 13, 16},
+		{KindMethod, "Get", "Getter", 14, 14},
+		{KindConst, "A", "", 19, 19},
+		{KindConst, "B", "", 20, 20},
+		{KindVariable, "x", "", 23, 23},
+		{KindVariable, "y", "", 23, 23},
+		{KindFunction, "F", "", 25, 25},
+	}},
+	{"java", "X.java", `package p;
+
+@Entity
+public class Outer<T extends Comparable<T>> {
+    private static final String BRACES = "{ not a block }";
+    private List<Map<String, T>> items;
+
+    public Outer(int n) {
+        // closing } in a comment
+        this.n = n;
+    }
+
+    @Override
+    public <R> List<R> map(Function<T, R> f) {
+        return null;
+    }
+
+    static class Inner {
+        void run() {}
+    }
+
+    interface Callback {
+        void done(String s);
+    }
+}
+
+enum Color { RED, GREEN }
+`, []Symbol{
+		{KindClass, "Outer", "", 4, 25},
+		{KindField, "BRACES", "Outer", 5, 5},
+		{KindField, "items", "Outer", 6, 6},
+		{KindConstructor, "Outer", "Outer", 8, 11},
+		{KindMethod, "map", "Outer", 14, 16},
+		{KindClass, "Inner", "Outer", 18, 20},
+		{KindMethod, "run", "Outer.Inner", 19, 19},
+		{KindInterface, "Callback", "Outer", 22, 24},
+		{KindMethod, "done", "Outer.Callback", 23, 23},
+		{KindEnum, "Color", "", 27, 27},
+	}},
+	{"kotlin", "x.kt", `package p
+
+data class User(val id: Int, val name: String) {
+    fun greet(): String = "hello {name}"
+
+    companion object {
+        const val MAX = 10
+        fun create(): User = User(0, "")
+    }
+}
+
+fun String.shout(): String {
+    return uppercase() + "}"
+}
+
+object Registry {
+    val users = mutableListOf<User>()
+}
+
+typealias Users = List<User>
+`, []Symbol{
+		{KindClass, "User", "", 3, 10},
+		{KindMethod, "greet", "User", 4, 4},
+		{KindObject, "Companion", "User", 6, 9},
+		{KindProperty, "MAX", "User.Companion", 7, 7},
+		{KindMethod, "create", "User.Companion", 8, 8},
+		{KindFunction, "shout", "String", 12, 14},
+		{KindObject, "Registry", "", 16, 18},
+		{KindProperty, "users", "Registry", 17, 17},
+		{KindType, "Users", "", 20, 20},
+	}},
+	{"typescript", "x.ts", `import { x } from "./x";
+
+export interface Shape {
+  area(): number;
+  name?: string;
+}
+
+export class Circle<T extends { r: number } = Shape> implements Shape {
+  private readonly r: number;
+  constructor(r: number) {
+    this.r = r;
+  }
+  @memo()
+  area(): number {
+    const s = ` + "`}${this.r}{`" + `;
+    return Math.PI * this.r ** 2;
+  }
+}
+
+export const make = (r: number): Circle<any> => new Circle(r);
+export type Id<T> = string;
+function helper() {
+  /* { */
+}
+`, []Symbol{
+		{KindInterface, "Shape", "", 3, 6},
+		{KindMethod, "area", "Shape", 4, 4},
+		{KindProperty, "name", "Shape", 5, 5},
+		{KindClass, "Circle", "", 8, 18},
+		{KindProperty, "r", "Circle", 9, 9},
+		{KindConstructor, "constructor", "Circle", 10, 12},
+		{KindMethod, "area", "Circle", 14, 17},
+		{KindFunction, "make", "", 20, 20},
+		{KindType, "Id", "", 21, 21},
+		{KindFunction, "helper", "", 22, 24},
+	}},
+	{"javascript", "x.js", `class A {
+  static #count = 0;
+  get size() { return 1; }
+  *gen() {}
+}
+module.exports = { A };
+`, []Symbol{
+		{KindClass, "A", "", 1, 5},
+		{KindProperty, "#count", "A", 2, 2},
+		{KindMethod, "size", "A", 3, 3},
+		{KindMethod, "gen", "A", 4, 4},
+	}},
+	{"rust", "x.rs", `use std::fmt;
+
+pub struct Point<T> {
+    pub x: T,
+    y: T,
+}
+
+impl<T: fmt::Display> fmt::Display for Point<T> {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let s = "} {";
+        let c = '{';
+        write!(f, "{}", s)
+    }
+}
+
+pub trait Shape {
+    fn area(&self) -> f64;
+}
+
+const MAX: usize = 10;
+
+macro_rules! square {
+    ($x:expr) => { $x * $x };
+}
+
+mod inner {
+    pub fn helper<'a>(s: &'a str) -> &'a str { s }
+}
+`, []Symbol{
+		{KindStruct, "Point", "", 3, 6},
+		{KindField, "x", "Point", 4, 4},
+		{KindField, "y", "Point", 5, 5},
+		{KindMethod, "fmt", "Point", 9, 13},
+		{KindTrait, "Shape", "", 16, 18},
+		{KindMethod, "area", "Shape", 17, 17},
+		{KindConst, "MAX", "", 20, 20},
+		{KindMacro, "square", "", 22, 24},
+		{KindModule, "inner", "", 26, 28},
+		{KindFunction, "helper", "inner", 27, 27},
+	}},
+	{"python", "x.py", `import os
+
+
+@dataclass
+class Config:
+    name: str = "x"
+    retries: int = 3
+
+    class Meta:
+        ordering = ["-id"]
+
+    @property
+    def label(self):
+        s = """
+def fake():
+    pass
+"""
+        return s
+
+    async def load(self,
+                   path):
+        pass
+
+
+def helper(x):
+    def inner():
+        return x
+    return inner
+
+
+TIMEOUT = 30
+`, []Symbol{
+		{KindClass, "Config", "", 5, 22},
+		{KindField, "name", "Config", 6, 6},
+		{KindField, "retries", "Config", 7, 7},
+		{KindClass, "Meta", "Config", 9, 10},
+		{KindField, "ordering", "Config.Meta", 10, 10},
+		{KindMethod, "label", "Config", 13, 18},
+		{KindMethod, "load", "Config", 20, 22},
+		{KindFunction, "helper", "", 25, 28},
+		{KindFunction, "inner", "", 26, 27},
+		{KindVariable, "TIMEOUT", "", 31, 31},
+	}},
+}
+
+func TestExtract(t *testing.T) {
+	for _, tc := range extractCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Extract(tc.path, []byte(tc.src))
+			if !reflect.DeepEqual(got, tc.want) {
+				for i := 0; i < max(len(got), len(tc.want)); i++ {
+					var g, w Symbol
+					if i < len(got) {
+						g = got[i]
+					}
+					if i < len(tc.want) {
+						w = tc.want[i]
+					}
+					if g != w {
+						t.Errorf("symbol %d: got %+v, want %+v", i, g, w)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	for path, want := range map[string]string{
+		"a.go": "go", "A.java": "java", "b.kts": "kotlin", "c.tsx": "ts", "d.mjs": "js", "e.pyi": "python",
+		"f.rs": "rust", "G.GO": "go", "h.c": "", "Makefile": "",
+	} {
+		if got := Language(path); got != want {
+			t.Errorf("Language(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
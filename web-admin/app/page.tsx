@@ -13,6 +13,7 @@ type Directory = {
   enabled: boolean;
   git_auto_update_interval_sec: number;
   git_last_updated_at: string | null;
+  use_vcs_ignore: boolean;
 };
 
 const GIT_INTERVALS: { value: number; label: string }[] = [
@@ -88,6 +89,15 @@ async function dirSetEnabled(id: number, enabled: boolean) {
   if (!r.ok) throw new Error('更新失败');
 }
 
+async function dirSetVCSIgnore(id: number, useVCSIgnore: boolean) {
+  const r = await fetch(`${API}/api/directories/${id}/vcs-ignore`, {
+    method: 'PATCH',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ use_vcs_ignore: useVCSIgnore }),
+  });
+  if (!r.ok) throw new Error('设置失败');
+}
+
 async function dirSetGitInterval(id: number, intervalSec: number) {
   const r = await fetch(`${API}/api/directories/${id}/git`, {
     method: 'PATCH',
@@ -116,6 +126,20 @@ async function ignorePut(content: string) {
   if (!r.ok) throw new Error('保存失败');
 }
 
+async function dirIgnoreGet(id: number): Promise<string> {
+  const r = await fetch(`${API}/api/directories/${id}/ignore`);
+  if (!r.ok) throw new Error('加载失败');
+  return r.text();
+}
+
+async function dirIgnorePut(id: number, content: string) {
+  const r = await fetch(`${API}/api/directories/${id}/ignore`, {
+    method: 'PUT',
+    body: content,
+  });
+  if (!r.ok) throw new Error('保存失败');
+}
+
 export default function AdminPage() {
   const [dirs, setDirs] = useState<Directory[]>([]);
   const [loading, setLoading] = useState(true);
@@ -128,6 +152,8 @@ export default function AdminPage() {
   const [addRole, setAddRole] = useState('');
   const [pullingId, setPullingId] = useState<number | null>(null);
   const [ignoreModalOpen, setIgnoreModalOpen] = useState(false);
+  // 编辑中的目录忽略规则；null 表示全局忽略文件
+  const [ignoreDir, setIgnoreDir] = useState<Directory | null>(null);
 
   const refreshDirs = useCallback(async () => {
     setDirMsg(null);
@@ -154,10 +180,12 @@ export default function AdminPage() {
     return () => { cancelled = true; };
   }, []);
 
-  const openIgnoreModal = useCallback(() => {
+  const openIgnoreModal = useCallback((d: Directory | null = null) => {
     setIgnoreModalOpen(true);
+    setIgnoreDir(d);
     setIgnoreMsg(null);
-    ignoreGet().then((t) => setIgnoreContent(t || '')).catch(() => {});
+    setIgnoreContent('');
+    (d ? dirIgnoreGet(d.id) : ignoreGet()).then((t) => setIgnoreContent(t || '')).catch(() => {});
   }, []);
 
   const handleAdd = async () => {
@@ -206,6 +234,16 @@ export default function AdminPage() {
     }
   };
 
+  const handleVCSIgnore = async (d: Directory) => {
+    setDirMsg(null);
+    try {
+      await dirSetVCSIgnore(d.id, !d.use_vcs_ignore);
+      await refreshDirs();
+    } catch (e) {
+      setDirMsg({ type: 'error', text: String((e as Error).message) });
+    }
+  };
+
   const handleGitInterval = async (id: number, intervalSec: number) => {
     setDirMsg(null);
     try {
@@ -232,14 +270,19 @@ export default function AdminPage() {
 
   const handleLoadIgnore = () => {
     setIgnoreMsg(null);
-    ignoreGet().then((t) => setIgnoreContent(t || '')).catch((e) => setIgnoreMsg({ type: 'error', text: String((e as Error).message) }));
+    (ignoreDir ? dirIgnoreGet(ignoreDir.id) : ignoreGet()).then((t) => setIgnoreContent(t || '')).catch((e) => setIgnoreMsg({ type: 'error', text: String((e as Error).message) }));
   };
 
   const handleSaveIgnore = async () => {
     setIgnoreMsg(null);
     try {
-      await ignorePut(ignoreContent);
-      setIgnoreMsg({ type: 'success', text: '已保存，热重载生效' });
+      if (ignoreDir) {
+        await dirIgnorePut(ignoreDir.id, ignoreContent);
+        setIgnoreMsg({ type: 'success', text: '已保存，下次搜索生效' });
+      } else {
+        await ignorePut(ignoreContent);
+        setIgnoreMsg({ type: 'success', text: '已保存，热重载生效' });
+      }
     } catch (e) {
       setIgnoreMsg({ type: 'error', text: String((e as Error).message) });
     }
@@ -255,7 +298,7 @@ export default function AdminPage() {
         <button
           type="button"
           className="rounded-md border border-zinc-300 bg-white px-3 py-1.5 text-sm font-medium text-zinc-700 hover:bg-zinc-50 dark:border-zinc-600 dark:bg-zinc-800 dark:text-zinc-300 dark:hover:bg-zinc-700"
-          onClick={openIgnoreModal}
+          onClick={() => openIgnoreModal()}
         >
           编辑忽略规则
         </button>
@@ -331,7 +374,7 @@ export default function AdminPage() {
           ) : dirs.length === 0 ? (
             <p className="py-8 text-center text-sm text-zinc-500">暂无目录，请在上方添加</p>
           ) : (
-            <table className="w-full min-w-[1280px] border-collapse text-sm">
+            <table className="w-full min-w-[1400px] border-collapse text-sm">
               <thead>
                 <tr className="border-b border-zinc-200 dark:border-zinc-700">
                   <th className="w-10 py-3 pr-2 text-left font-medium text-zinc-600 dark:text-zinc-400">ID</th>
@@ -340,8 +383,9 @@ export default function AdminPage() {
                   <th className="w-24 py-3 pr-2 text-left font-medium text-zinc-600 dark:text-zinc-400">语言</th>
                   <th className="w-24 py-3 pr-2 text-left font-medium text-zinc-600 dark:text-zinc-400">角色</th>
                   <th className="w-14 py-3 pr-2 text-left font-medium text-zinc-600 dark:text-zinc-400">启用</th>
+                  <th className="w-28 py-3 pr-2 text-left font-medium text-zinc-600 dark:text-zinc-400" title="搜索时遵循仓库的 .gitignore 与 .git/info/exclude">遵循 .gitignore</th>
                   <th className="min-w-[200px] py-3 pr-2 text-left font-medium text-zinc-600 dark:text-zinc-400">Git 自动更新</th>
-                  <th className="w-28 py-3 text-left font-medium text-zinc-600 dark:text-zinc-400">操作</th>
+                  <th className="w-44 py-3 text-left font-medium text-zinc-600 dark:text-zinc-400">操作</th>
                 </tr>
               </thead>
               <tbody>
@@ -353,6 +397,14 @@ export default function AdminPage() {
                     <td className="py-2.5 pr-2 text-zinc-600 dark:text-zinc-400">{d.language || '—'}</td>
                     <td className="py-2.5 pr-2 text-zinc-600 dark:text-zinc-400">{d.role || '—'}</td>
                     <td className="py-2.5 pr-2">{d.enabled ? '是' : '否'}</td>
+                    <td className="py-2.5 pr-2">
+                      <input
+                        type="checkbox"
+                        className="h-4 w-4 cursor-pointer"
+                        checked={d.use_vcs_ignore ?? true}
+                        onChange={() => handleVCSIgnore(d)}
+                      />
+                    </td>
                     <td className="py-2.5 pr-2">
                       <div className="flex flex-wrap items-center gap-2">
                         <select
@@ -384,6 +436,13 @@ export default function AdminPage() {
                         >
                           {d.enabled ? '禁用' : '启用'}
                         </button>
+                        <button
+                          type="button"
+                          className="rounded bg-zinc-200 px-2 py-1 text-xs hover:bg-zinc-300 dark:bg-zinc-700 dark:hover:bg-zinc-600"
+                          onClick={() => openIgnoreModal(d)}
+                        >
+                          忽略规则
+                        </button>
                         <button
                           type="button"
                           className="rounded bg-red-100 px-2 py-1 text-xs text-red-700 hover:bg-red-200 dark:bg-red-900/30 dark:text-red-400 dark:hover:bg-red-900/50"
@@ -414,8 +473,14 @@ export default function AdminPage() {
             className="w-full max-w-2xl rounded-xl border border-zinc-200 bg-white p-6 shadow-xl dark:border-zinc-700 dark:bg-zinc-900"
             onClick={(e) => e.stopPropagation()}
           >
-            <h2 id="ignore-modal-title" className="mb-1 text-lg font-semibold text-zinc-800 dark:text-zinc-200">编辑忽略规则</h2>
-            <p className="mb-4 text-sm text-zinc-500 dark:text-zinc-400">gitignore 格式，每行一条；保存后热重载，无需重启。</p>
+            <h2 id="ignore-modal-title" className="mb-1 text-lg font-semibold text-zinc-800 dark:text-zinc-200">
+              {ignoreDir ? `编辑目录忽略规则：${ignoreDir.name}` : '编辑忽略规则'}
+            </h2>
+            <p className="mb-4 text-sm text-zinc-500 dark:text-zinc-400">
+              {ignoreDir
+                ? 'gitignore 格式，每行一条，路径相对该目录根；叠加在全局忽略规则之上（可用 !pattern 重新包含全局规则排除的路径）。'
+                : 'gitignore 格式，每行一条；保存后热重载，无需重启。'}
+            </p>
             <textarea
               value={ignoreContent}
               onChange={(e) => setIgnoreContent(e.target.value)}